@@ -6,16 +6,26 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/robertprast/goop/pkg/audit"
+	"github.com/robertprast/goop/pkg/engine"
 	"github.com/robertprast/goop/pkg/proxy"
 	"github.com/robertprast/goop/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
 
+// version and commit are set at build time with -ldflags "-X main.version=... -X main.commit=..."
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
 // App holds the application configurations and dependencies
 type App struct {
 	Config           *utils.Config
@@ -23,19 +33,34 @@ type App struct {
 	Logger           *logrus.Logger
 	Metrics          *proxy.Metrics
 	OpenProxyMetrics *proxy.OpenaiProxyMetrics
+	Streams          *proxy.StreamTracker
+	Engines          *proxy.EngineCache
+	ConfigPath       string
 	Healthy          int32
 }
 
+// shutdownTimeout bounds graceful shutdown, streams get all but streamDrainMargin of it to finish
+const (
+	shutdownTimeout   = 5 * time.Second
+	streamDrainMargin = 1 * time.Second
+)
+
+// readinessTimeout bounds each engine check made by /readyz
+const readinessTimeout = 2 * time.Second
+
 func main() {
 	app := &App{
 		Logger:           logrus.New(),
 		Metrics:          proxy.NewProxyMetrics(),
 		OpenProxyMetrics: proxy.NewOpenaiProxyMetrics(),
+		Streams:          proxy.NewStreamTracker(),
 	}
 
 	// Initialize components
 	app.InitLogger()
-	app.InitConfig("config.yml")
+	app.InitConfig(utils.GetEnv("GOOP_CONFIG_PATH", "config.yml"))
+	app.InitEngines()
+	app.InitAudit()
 	app.InitHealth()
 	app.InitRouter()
 
@@ -49,13 +74,41 @@ func (app *App) InitLogger() {
 	app.Logger.SetLevel(logrus.InfoLevel)
 }
 
-// InitConfig loads the configuration from a file
+// InitConfig loads the configuration from a file, or from the environment if the file doesn't exist
 func (app *App) InitConfig(configPath string) {
 	config, err := utils.LoadConfig(configPath)
 	if err != nil {
 		app.Logger.Fatalf("Error loading configuration: %v", err)
 	}
 	app.Config = &config
+	app.ConfigPath = configPath
+}
+
+// InitEngines creates the engine cache and reloads engine configs on SIGHUP,
+// so rotated credentials are picked up without a restart
+func (app *App) InitEngines() {
+	app.Engines = proxy.NewEngineCache(app.Config.Engines)
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			config, err := utils.LoadConfig(app.ConfigPath)
+			if err != nil {
+				app.Logger.Errorf("Error reloading configuration, keeping current engines: %v", err)
+				continue
+			}
+			app.Engines.Reload(config.Engines)
+			app.Logger.Info("Reloaded engine configuration")
+		}
+	}()
+}
+
+// InitAudit configures the audit sink
+func (app *App) InitAudit() {
+	if err := audit.Configure(app.Config.Audit); err != nil {
+		app.Logger.Fatalf("Error configuring audit sink: %v", err)
+	}
 }
 
 // InitHealth initializes health status
@@ -67,13 +120,15 @@ func (app *App) InitHealth() {
 func (app *App) InitRouter() {
 	mux := http.NewServeMux()
 
-	proxyHandler := proxy.NewProxyHandler(app.Config, app.Logger, app.Metrics)
-	openAIProxyHandler := proxy.NewHandler(app.Config, app.Logger, app.OpenProxyMetrics)
+	proxyHandler := proxy.NewProxyHandler(app.Config, app.Engines, app.Logger, app.Metrics)
+	openAIProxyHandler := proxy.NewHandler(app.Config, app.Engines, app.Logger, app.OpenProxyMetrics, app.Streams)
 
 	mux.Handle("/", proxyHandler)
 	mux.Handle("/openai-proxy/", openAIProxyHandler)
 
 	mux.HandleFunc("/healthz", app.healthHandler)
+	mux.HandleFunc("/readyz", app.readyHandler)
+	mux.HandleFunc("/version", app.versionHandler)
 	mux.Handle("/metrics", promhttp.Handler())
 
 	app.Router = mux
@@ -102,11 +157,101 @@ func (app *App) healthHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// versionHandler handles the /version endpoint
+func (app *App) versionHandler(w http.ResponseWriter, r *http.Request) {
+	response := struct {
+		Version   string `json:"version"`
+		Commit    string `json:"commit"`
+		GoVersion string `json:"go_version"`
+	}{
+		Version:   version,
+		Commit:    commit,
+		GoVersion: runtime.Version(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		app.Logger.Errorf("Error encoding version response: %v", err)
+	}
+}
+
+// readyHandler handles the /readyz endpoint. The pod is ready when at least
+// one enabled engine's upstream answers within readinessTimeout.
+func (app *App) readyHandler(w http.ResponseWriter, r *http.Request) {
+	names := app.Engines.Names()
+	statuses := make(map[string]string, len(names))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			status := app.checkEngine(r.Context(), name)
+			mu.Lock()
+			statuses[name] = status
+			mu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+
+	reachable := false
+	for _, status := range statuses {
+		if status == "ok" {
+			reachable = true
+		}
+	}
+	ready := atomic.LoadInt32(&app.Healthy) == 1 && reachable
+	response := struct {
+		Status  string            `json:"status"`
+		Engines map[string]string `json:"engines"`
+	}{
+		Status:  "ready",
+		Engines: statuses,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if ready {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		response.Status = "not ready"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		app.Logger.Errorf("Error encoding readiness response: %v", err)
+	}
+}
+
+// checkEngine reports "ok" when the engine can be created and its upstream
+// answers a probe within readinessTimeout, otherwise the reason it is unavailable.
+// The probe runs on the check's context, so nothing outlives the timeout.
+func (app *App) checkEngine(ctx context.Context, name string) string {
+	eng, err := app.Engines.Get(name)
+	if err != nil {
+		return err.Error()
+	}
+	prober, ok := eng.(engine.Prober)
+	if !ok {
+		// Nothing to probe, creating the engine is all that can be checked
+		return "ok"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+	if err := prober.Probe(ctx); err != nil {
+		if ctx.Err() != nil {
+			return "timeout"
+		}
+		return err.Error()
+	}
+	return "ok"
+}
+
 // StartServer starts the HTTP server and handles graceful shutdown
 func (app *App) StartServer() {
 	srv := &http.Server{
-		Addr:    ":8080",
-		Handler: app.Router,
+		Addr:           ":8080",
+		Handler:        app.Router,
+		MaxHeaderBytes: app.Config.Server.MaxHeaderBytes,
 	}
 
 	// Channel to listen for interrupt or terminate signals
@@ -128,9 +273,20 @@ func (app *App) StartServer() {
 
 	// Create a deadline to wait for graceful shutdown
 	app.Logger.Info("Shutting down server...")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
+
+	// Stop accepting connections while in-flight streams drain. Streams still
+	// running near the deadline are told to stop and finish with [DONE].
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- srv.Shutdown(ctx)
+	}()
+	drainCtx, drainCancel := context.WithTimeout(ctx, shutdownTimeout-streamDrainMargin)
+	defer drainCancel()
+	app.Streams.Drain(drainCtx)
+
+	if err := <-shutdownErr; err != nil {
 		app.Logger.Fatalf("Server Shutdown Failed:%+v", err)
 	}
 
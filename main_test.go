@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/robertprast/goop/pkg/proxy"
+	"github.com/sirupsen/logrus"
+)
+
+func TestReadyHandler(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A rejected key still means the backend is reachable
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	tests := []struct {
+		name       string
+		baseURL    string
+		wantStatus int
+		wantEngine string
+	}{
+		{name: "reachable backend", baseURL: up.URL + "/v1", wantStatus: http.StatusOK, wantEngine: "ok"},
+		{name: "failing backend", baseURL: down.URL + "/v1", wantStatus: http.StatusServiceUnavailable, wantEngine: "upstream returned status 503"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &App{
+				Logger: logrus.New(),
+				Engines: proxy.NewEngineCache(map[string]string{
+					"openai":  "api_key: test\nbase_url: " + tt.baseURL + "\n",
+					"bedrock": "enabled: false\n",
+				}),
+				Healthy: 1,
+			}
+
+			rec := httptest.NewRecorder()
+			app.readyHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			var body struct {
+				Engines map[string]string `json:"engines"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if got := body.Engines["openai"]; got != tt.wantEngine {
+				t.Errorf("openai status = %q, want %q", got, tt.wantEngine)
+			}
+			if _, ok := body.Engines["bedrock"]; ok {
+				t.Error("disabled bedrock engine was checked")
+			}
+		})
+	}
+}
+
+func TestReadyHandlerTimesOutHangingEngine(t *testing.T) {
+	var inFlight int32
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		<-r.Context().Done()
+	}))
+	defer hanging.Close()
+
+	app := &App{
+		Logger:  logrus.New(),
+		Engines: proxy.NewEngineCache(map[string]string{"ollama": "base_url: " + hanging.URL}),
+		Healthy: 1,
+	}
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	app.readyHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if elapsed := time.Since(start); elapsed > readinessTimeout+time.Second {
+		t.Errorf("readyz took %s, want about %s", elapsed, readinessTimeout)
+	}
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"ollama":"timeout"`) {
+		t.Errorf("status = %d, body = %s, want a 503 with ollama timed out", rec.Code, rec.Body)
+	}
+
+	// The probe is cancelled with the check instead of outliving it
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&inFlight) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("probe request still in flight after the readiness check returned")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -1,7 +1,6 @@
 package audit
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"io"
@@ -11,30 +10,42 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// drainBody reads all of b to memory and then returns two equivalent
-// ReadClosers yielding the same bytes.
+// drainBody reads up to limit bytes of b to memory and then returns two
+// ReadClosers: r1 yields the full body, r2 yields only the captured bytes.
+// When the body is larger than limit, r1 streams the remainder from b so the
+// full body is still forwarded downstream without being held in memory, and
+// truncated is set.
 //
-// It returns an error if the initial slurp of all bytes fails. It does not attempt
+// It returns an error if the initial read fails. It does not attempt
 // to make the returned ReadClosers have identical error-matching behavior.
-func drainBody(b io.ReadCloser) (r1, r2 io.ReadCloser, err error) {
+func drainBody(b io.ReadCloser, limit int64) (r1, r2 io.ReadCloser, truncated bool, err error) {
 	if b == nil || b == http.NoBody {
 		// No copying needed. Preserve the magic sentinel meaning of NoBody.
-		return http.NoBody, http.NoBody, nil
+		return http.NoBody, http.NoBody, false, nil
 	}
 	var buf bytes.Buffer
-	if _, err = buf.ReadFrom(b); err != nil {
-		return nil, b, err
+	if _, err = buf.ReadFrom(io.LimitReader(b, limit+1)); err != nil {
+		return nil, b, false, err
+	}
+	if int64(buf.Len()) > limit {
+		captured := buf.Bytes()[:limit]
+		forward := struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf.Bytes()), b), b}
+		return forward, io.NopCloser(bytes.NewReader(captured)), true, nil
 	}
 	if err = b.Close(); err != nil {
-		return nil, b, err
+		return nil, b, false, err
 	}
-	return io.NopCloser(&buf), io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	return io.NopCloser(&buf), io.NopCloser(bytes.NewReader(buf.Bytes())), false, nil
 }
 
 // Request Audit request will drain the request body and log the request
-// method, URL, headers, and body.
+// method, URL, headers, and body. Only the first maxBodyBytes of the body
+// are captured, the full body is always forwarded.
 func Request(r *http.Request) error {
-	body1, body2, err := drainBody(r.Body)
+	body1, body2, truncated, err := drainBody(r.Body, maxBodyBytes)
 	defer func(body2 io.ReadCloser) {
 		err := body2.Close()
 		if err != nil {
@@ -43,18 +54,24 @@ func Request(r *http.Request) error {
 	}(body2)
 	if err != nil {
 		logrus.Errorf("Error draining body: %v", err)
-		return fmt.Errorf("error draining body: %v", err)
+		return fmt.Errorf("error draining body: %w", err)
 	}
 	r.Body = body1
 
 	rawBody, err := io.ReadAll(body2)
 	if err != nil {
 		logrus.Errorf("Error reading body: %v", err)
-		return fmt.Errorf("error reading body: %v", err)
+		return fmt.Errorf("error reading body: %w", err)
+	}
+	if truncated {
+		logrus.WithField("truncated", true).Warnf("Audit body for %s %s truncated to %d bytes",
+			r.Method, r.URL.Path, maxBodyBytes)
 	}
 
-	logrus.Debugf("Request: %s %s\nHeaders: %v\nBody: len(%d)\n Raw Body: %v\n",
-		r.Method, r.URL.String(), r.Header, r.ContentLength, string(rawBody))
+	if err := sink.RecordRequest(r, RedactBody(rawBody)); err != nil {
+		logrus.Errorf("Error recording audit request: %v", err)
+		return fmt.Errorf("error recording audit request: %v", err)
+	}
 	return nil
 }
 
@@ -64,7 +81,7 @@ func Request(r *http.Request) error {
 // response body for auditing.
 func Response(resp *http.Response) error {
 	eng := engine.FromContext(resp.Request.Context())
-	if eng == nil {
+	if eng == nil || !sampled(resp.Request.Context()) {
 		return nil
 	}
 
@@ -72,28 +89,48 @@ func Response(resp *http.Response) error {
 	pr, pw := io.Pipe()
 	resp.Body = pr
 
+	// The copy ends when the upstream body is done or the reader side of the
+	// pipe is closed (e.g. the client went away), closing both bodies either way
 	go func() {
-		var respBodyBuf bytes.Buffer
-		scanner := bufio.NewScanner(originalBody)
-		scanner.Split(bufio.ScanBytes)
-		for scanner.Scan() {
-			b := scanner.Bytes()
-			respBodyBuf.Write(b)
-			_, err := pw.Write(b)
-			if err != nil {
-				return
-			}
+		respBodyBuf := &cappedBuffer{limit: maxBodyBytes}
+		_, err := io.Copy(pw, io.TeeReader(originalBody, respBodyBuf))
+		if closeErr := originalBody.Close(); closeErr != nil {
+			logrus.Debugf("Error closing upstream response body: %v", closeErr)
 		}
-		err := originalBody.Close()
+		// A nil error closes the pipe with io.EOF, anything else is passed on to the reader
+		_ = pw.CloseWithError(err)
 		if err != nil {
+			logrus.Warnf("Response stream ended early, skipping audit: %v", err)
 			return
 		}
-		err = pw.Close()
-		if err != nil {
-			return
+		if respBodyBuf.truncated {
+			logrus.WithField("truncated", true).Warnf("Audit body truncated to %d bytes", maxBodyBytes)
 		}
 		eng.ResponseCallback(resp, bytes.NewReader(respBodyBuf.Bytes()))
+		if err := sink.RecordResponse(resp, RedactBody(respBodyBuf.Bytes())); err != nil {
+			logrus.Errorf("Error recording audit response: %v", err)
+		}
 	}()
 
 	return nil
 }
+
+// cappedBuffer keeps the first limit bytes written to it and discards the
+// rest, so auditing a large response doesn't hold all of it in memory
+type cappedBuffer struct {
+	bytes.Buffer
+	limit     int64
+	truncated bool
+}
+
+// Write never fails, bytes past the limit are counted as written and dropped
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	if room := c.limit - int64(c.Len()); room < int64(len(p)) {
+		c.truncated = true
+		if room > 0 {
+			c.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return c.Buffer.Write(p)
+}
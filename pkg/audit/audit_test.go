@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+)
+
+const benchmarkBodySize = 1 << 20
+
+// scannerTee is the tee Response used before it switched to io.Copy, reading
+// the upstream body one byte at a time with a bufio.Scanner
+func scannerTee(body io.ReadCloser, pw *io.PipeWriter) *bytes.Buffer {
+	var buf bytes.Buffer
+	scanner := bufio.NewScanner(body)
+	scanner.Split(bufio.ScanBytes)
+	for scanner.Scan() {
+		b := scanner.Bytes()
+		buf.Write(b)
+		if _, err := pw.Write(b); err != nil {
+			break
+		}
+	}
+	_ = body.Close()
+	_ = pw.Close()
+	return &buf
+}
+
+// copyTee is the tee Response uses, as in its goroutine
+func copyTee(body io.ReadCloser, pw *io.PipeWriter) *bytes.Buffer {
+	buf := &cappedBuffer{limit: maxBodyBytes}
+	_, err := io.Copy(pw, io.TeeReader(body, buf))
+	_ = body.Close()
+	_ = pw.CloseWithError(err)
+	return &buf.Buffer
+}
+
+func benchmarkTee(b *testing.B, tee func(io.ReadCloser, *io.PipeWriter) *bytes.Buffer) {
+	body := bytes.Repeat([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\n"), benchmarkBodySize/50)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pr, pw := io.Pipe()
+		go tee(io.NopCloser(bytes.NewReader(body)), pw)
+		if _, err := io.Copy(io.Discard, pr); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkResponseTeeScanner(b *testing.B) { benchmarkTee(b, scannerTee) }
+
+func BenchmarkResponseTeeCopy(b *testing.B) { benchmarkTee(b, copyTee) }
+
+func TestCappedBuffer(t *testing.T) {
+	buf := &cappedBuffer{limit: 5}
+	for _, chunk := range []string{"abc", "def", "ghi"} {
+		if n, err := buf.Write([]byte(chunk)); n != len(chunk) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v, want %d, nil", chunk, n, err, len(chunk))
+		}
+	}
+	if got := buf.String(); got != "abcde" {
+		t.Errorf("buffer = %q, want %q", got, "abcde")
+	}
+	if !buf.truncated {
+		t.Error("truncated = false, want true")
+	}
+}
+
+func TestCopyTeeForwardsFullBody(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), int(maxBodyBytes)+100)
+	pr, pw := io.Pipe()
+	captured := make(chan *bytes.Buffer, 1)
+	go func() { captured <- copyTee(io.NopCloser(bytes.NewReader(body)), pw) }()
+
+	forwarded, err := io.ReadAll(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(forwarded) != len(body) {
+		t.Errorf("forwarded %d bytes, want %d", len(forwarded), len(body))
+	}
+	if got := (<-captured).Len(); int64(got) != maxBodyBytes {
+		t.Errorf("captured %d bytes, want %d", got, maxBodyBytes)
+	}
+}
@@ -0,0 +1,73 @@
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	_ "github.com/lib/pq"
+)
+
+const createAuditLogTable = `
+CREATE TABLE IF NOT EXISTS audit_log (
+	id          BIGSERIAL PRIMARY KEY,
+	request_id  TEXT,
+	direction   TEXT NOT NULL,
+	method      TEXT,
+	url         TEXT,
+	status_code INTEGER,
+	headers     JSONB,
+	body        BYTEA,
+	created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+const insertAuditLog = `
+INSERT INTO audit_log (request_id, direction, method, url, status_code, headers, body)
+VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+// postgresSink writes audited requests and responses to the audit_log table
+type postgresSink struct {
+	db *sql.DB
+}
+
+func newPostgresSink(dsn string) (*postgresSink, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("audit postgres sink requires postgres_dsn")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("error connecting to audit database: %w", err)
+	}
+	if _, err := db.Exec(createAuditLogTable); err != nil {
+		return nil, fmt.Errorf("error creating audit_log table: %w", err)
+	}
+	return &postgresSink{db: db}, nil
+}
+
+func (s *postgresSink) RecordRequest(r *http.Request, body []byte) error {
+	return s.insert(requestID(r), "request", r.Method, r.URL.String(), nil, r.Header, body)
+}
+
+func (s *postgresSink) RecordResponse(resp *http.Response, body []byte) error {
+	var method, url string
+	if resp.Request != nil {
+		method, url = resp.Request.Method, resp.Request.URL.String()
+	}
+	return s.insert(requestID(resp.Request), "response", method, url, resp.StatusCode, resp.Header, body)
+}
+
+func (s *postgresSink) insert(requestID, direction, method, url string, status interface{}, headers http.Header, body []byte) error {
+	headersJSON, err := json.Marshal(RedactHeaders(headers))
+	if err != nil {
+		return fmt.Errorf("error marshaling audit headers: %w", err)
+	}
+	_, err = s.db.Exec(insertAuditLog, requestID, direction, method, url, status, string(headersJSON), body)
+	if err != nil {
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package audit
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// RedactFunc masks sensitive data in an audited body. It must return a new
+// slice rather than modify body, which may share memory with the forwarded body.
+type RedactFunc func(body []byte) []byte
+
+var redact RedactFunc
+
+// redactPresets are the named patterns accepted in audit.redact_patterns
+var redactPresets = map[string]string{
+	"email": `[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`,
+	// Phone numbers need separators so timestamps and IDs aren't masked
+	"phone": `(?:\+\d{1,3}[\s.\-]?)?(?:\(\d{3}\)\s?|\b\d{3}[\s.\-])\d{3}[\s.\-]\d{4}\b`,
+}
+
+// SetRedactFunc sets the function applied to bodies before they are logged
+// or stored. nil disables redaction.
+func SetRedactFunc(fn RedactFunc) {
+	redact = fn
+}
+
+// NewPatternRedactor returns a RedactFunc replacing every match of patterns
+// with [REDACTED]. A pattern is either a preset name ("email", "phone") or a
+// regular expression.
+func NewPatternRedactor(patterns []string) (RedactFunc, error) {
+	var regexps []*regexp.Regexp
+	for _, pattern := range patterns {
+		if preset, ok := redactPresets[pattern]; ok {
+			pattern = preset
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid audit redact pattern %q: %w", pattern, err)
+		}
+		regexps = append(regexps, re)
+	}
+
+	return func(body []byte) []byte {
+		for _, re := range regexps {
+			body = re.ReplaceAll(body, []byte("[REDACTED]"))
+		}
+		return body
+	}, nil
+}
+
+// RedactBody applies the configured RedactFunc to body
+func RedactBody(body []byte) []byte {
+	if redact == nil || len(body) == 0 {
+		return body
+	}
+	return redact(body)
+}
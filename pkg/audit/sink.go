@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+
+	"github.com/robertprast/goop/pkg/engine"
+	"github.com/robertprast/goop/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultMaxBodyBytes caps how much of a request or response body is captured
+// for the sink when audit.max_body_bytes isn't set
+const defaultMaxBodyBytes = 1 << 20
+
+var maxBodyBytes int64 = defaultMaxBodyBytes
+
+var (
+	enabled    = true
+	sampleRate = 1.0
+)
+
+// sampledCtxKey marks requests picked for auditing, so their responses are audited too
+type sampledCtxKey struct{}
+
+// AuditSink persists audited requests and responses
+type AuditSink interface {
+	RecordRequest(r *http.Request, body []byte) error
+	RecordResponse(resp *http.Response, body []byte) error
+}
+
+var sink AuditSink = logrusSink{}
+
+// Configure selects the audit sink and body cap from config. The logrus sink is used when none is set.
+func Configure(cfg utils.AuditConfig) error {
+	enabled = cfg.Enabled == nil || *cfg.Enabled
+	sampleRate = 1
+	if cfg.SampleRate != nil {
+		if *cfg.SampleRate < 0 || *cfg.SampleRate > 1 {
+			return fmt.Errorf("audit sample_rate must be between 0 and 1, got %v", *cfg.SampleRate)
+		}
+		sampleRate = *cfg.SampleRate
+	}
+	if !enabled {
+		logrus.Info("Auditing is disabled")
+	} else if sampleRate < 1 {
+		logrus.Infof("Auditing %.0f%% of requests", sampleRate*100)
+	}
+
+	maxBodyBytes = defaultMaxBodyBytes
+	if cfg.MaxBodyBytes > 0 {
+		maxBodyBytes = cfg.MaxBodyBytes
+	}
+
+	redact = nil
+	if len(cfg.RedactPatterns) > 0 {
+		fn, err := NewPatternRedactor(cfg.RedactPatterns)
+		if err != nil {
+			return err
+		}
+		redact = fn
+		logrus.Infof("Redacting %d pattern(s) from audited bodies", len(cfg.RedactPatterns))
+	}
+
+	if cfg.Sink == "" {
+		cfg.Sink = "logrus"
+	}
+	switch cfg.Sink {
+	case "logrus":
+		sink = logrusSink{}
+	case "postgres":
+		pgSink, err := newPostgresSink(cfg.PostgresDSN)
+		if err != nil {
+			return err
+		}
+		sink = pgSink
+	default:
+		return fmt.Errorf("unknown audit sink: %s", cfg.Sink)
+	}
+	logrus.Infof("Using %q audit sink", cfg.Sink)
+	return nil
+}
+
+// Sample decides whether r is audited, honoring audit.enabled and
+// audit.sample_rate. Sampled requests are returned marked so Response audits
+// their responses as well.
+func Sample(r *http.Request) (*http.Request, bool) {
+	if !enabled || (sampleRate < 1 && rand.Float64() >= sampleRate) {
+		return r, false
+	}
+	return r.WithContext(context.WithValue(r.Context(), sampledCtxKey{}, true)), true
+}
+
+// sampled reports whether ctx belongs to a request picked by Sample
+func sampled(ctx context.Context) bool {
+	picked, _ := ctx.Value(sampledCtxKey{}).(bool)
+	return picked
+}
+
+// logrusSink logs audited bodies at debug level
+type logrusSink struct{}
+
+func (logrusSink) RecordRequest(r *http.Request, body []byte) error {
+	logrus.Debugf("Request: %s %s\nHeaders: %v\nBody: len(%d)\n Raw Body: %v\n",
+		r.Method, r.URL.String(), RedactHeaders(r.Header), r.ContentLength, string(body))
+	return nil
+}
+
+func (logrusSink) RecordResponse(resp *http.Response, body []byte) error {
+	logrus.Debugf("Response [HTTP %d] Correlation ID: %s\nHeaders: %v\nBody: %v\n",
+		resp.StatusCode, requestID(resp.Request), RedactHeaders(resp.Header), string(body))
+	return nil
+}
+
+// RedactHeaders returns a copy of h with credential headers masked
+func RedactHeaders(h http.Header) http.Header {
+	redacted := h.Clone()
+	for name := range redacted {
+		switch strings.ToLower(name) {
+		case "authorization", "api-key", "x-api-key", "cookie", "set-cookie":
+			redacted.Set(name, "[REDACTED]")
+		}
+	}
+	return redacted
+}
+
+func requestID(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	id, _ := r.Context().Value(engine.RequestId).(string)
+	return id
+}
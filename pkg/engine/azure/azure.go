@@ -7,20 +7,37 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/robertprast/goop/pkg/engine"
+	"github.com/robertprast/goop/pkg/utils"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
 
 type BackendConfig struct {
-	BaseUrl     string `yaml:"base_url"`
-	APIKey      string `yaml:"api_key"`
-	APIVersion  string `yaml:"api_version"`
+	BaseUrl    string `yaml:"base_url"`
+	APIKey     string `yaml:"api_key"`
+	APIVersion string `yaml:"api_version"`
+	// Deployments maps OpenAI model names to Azure deployment names
+	Deployments map[string]string `yaml:"deployments"`
+	// HealthCheckPath is requested by health checks, defaults to the models list
+	HealthCheckPath string `yaml:"health_check_path"`
+	// StreamIdleTimeout aborts a stream when no data arrives within the window. Zero disables it.
+	StreamIdleTimeout time.Duration `yaml:"stream_idle_timeout"`
+	// StreamFlushBytes and StreamFlushInterval coalesce streamed chunks before
+	// flushing them to the client. Zero flushes every chunk.
+	StreamFlushBytes    int           `yaml:"stream_flush_bytes"`
+	StreamFlushInterval time.Duration `yaml:"stream_flush_interval"`
+	// TLS configures a private CA or client certificate for the backend
+	TLS         utils.TLSConfig `yaml:"tls"`
 	BackendURL  *url.URL
 	IsActive    bool
 	Connections int64
+
+	transport http.RoundTripper
 }
 
 type AzureOpenAIEngine struct {
@@ -28,6 +45,8 @@ type AzureOpenAIEngine struct {
 	whitelist map[string]struct{}
 	prefix    string
 	logger    *logrus.Entry
+	stop      chan struct{}
+	stopOnce  sync.Once
 }
 
 func NewAzureOpenAIEngineWithConfig(configStr string) (*AzureOpenAIEngine, error) {
@@ -39,18 +58,29 @@ func NewAzureOpenAIEngineWithConfig(configStr string) (*AzureOpenAIEngine, error
 	}
 
 	var backends []*BackendConfig
-	for _, cfg := range config {
+	for i, cfg := range config {
 		url, err := url.Parse(cfg.BaseUrl)
 		if err != nil {
 			return nil, err
 		}
+		transport, err := utils.NewTransport(cfg.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing Azure config: backend at index %d: %w", i, err)
+		}
 
 		backends = append(backends, &BackendConfig{
-			BackendURL:  url,
-			APIKey:      cfg.APIKey,
-			APIVersion:  cfg.APIVersion,
-			IsActive:    true,
-			Connections: 0,
+			BackendURL:      url,
+			APIKey:          cfg.APIKey,
+			APIVersion:      cfg.APIVersion,
+			Deployments:     cfg.Deployments,
+			HealthCheckPath: cfg.HealthCheckPath,
+			IsActive:        true,
+			Connections:     0,
+
+			StreamIdleTimeout:   cfg.StreamIdleTimeout,
+			StreamFlushBytes:    cfg.StreamFlushBytes,
+			StreamFlushInterval: cfg.StreamFlushInterval,
+			transport:           transport,
 		})
 	}
 
@@ -69,6 +99,7 @@ func NewAzureOpenAIEngineWithConfig(configStr string) (*AzureOpenAIEngine, error
 		whitelist: whitelist,
 		prefix:    "/azure",
 		logger:    logrus.WithField("engine", "azure"),
+		stop:      make(chan struct{}),
 	}
 	engine.startHealthCheck()
 	return engine, nil
@@ -104,7 +135,12 @@ func (e *AzureOpenAIEngine) ModifyRequest(r *http.Request) {
 	atomic.AddInt64(&backend.Connections, 1)
 	defer atomic.AddInt64(&backend.Connections, -1)
 
-	r.URL.Path = strings.Replace(r.URL.Path, "/azure", "/openai_schema", 1)
+	path := strings.TrimPrefix(r.URL.Path, e.prefix)
+	if rest, found := strings.CutPrefix(path, "/deployments/"); found {
+		name, route, _ := strings.Cut(rest, "/")
+		path = "/deployments/" + backend.ResolveDeployment(name) + "/" + route
+	}
+	r.URL.Path = "/openai" + path
 
 	r.Host = backend.BackendURL.Host
 	r.URL.Scheme = backend.BackendURL.Scheme
@@ -127,6 +163,33 @@ func (e *AzureOpenAIEngine) ResponseCallback(resp *http.Response, body io.Reader
 		resp.StatusCode, id, resp.ContentLength)
 }
 
+// ResolveDeployment returns the deployment configured for model, or model itself
+// when there is no mapping so clients can still address deployments directly
+func (b *BackendConfig) ResolveDeployment(model string) string {
+	if deployment, ok := b.Deployments[model]; ok {
+		return deployment
+	}
+	return model
+}
+
+// Transport returns the round tripper for requests to the backend
+func (b *BackendConfig) Transport() http.RoundTripper {
+	if b.transport == nil {
+		return http.DefaultTransport
+	}
+	return b.transport
+}
+
+// ChatCompletionsURL builds the Azure chat completions URL for a model name,
+// e.g. "azure/gpt-4o" -> {base}/openai/deployments/{deployment}/chat/completions?api-version=...
+func (b *BackendConfig) ChatCompletionsURL(model string) string {
+	deployment := b.ResolveDeployment(strings.TrimPrefix(model, "azure/"))
+	u := *b.BackendURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/openai/deployments/" + url.PathEscape(deployment) + "/chat/completions"
+	u.RawQuery = url.Values{"api-version": {b.APIVersion}}.Encode()
+	return u.String()
+}
+
 func extractDeploymentRoute(path string) string {
 	parts := strings.Split(path, "/")
 	if len(parts) > 4 {
@@ -1,12 +1,15 @@
 package azure
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync/atomic"
 	"time"
 
+	"github.com/robertprast/goop/pkg/engine"
 	"github.com/sirupsen/logrus"
 )
 
@@ -14,12 +17,24 @@ import (
 func (e *AzureOpenAIEngine) startHealthCheck() {
 	ticker := time.NewTicker(5 * time.Second)
 	go func() {
-		for range ticker.C {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-e.stop:
+				return
+			case <-ticker.C:
+			}
 			for _, backend := range e.backends {
-				backend.IsActive = isBackendAvailable(backend.BackendURL)
-				if backend.IsActive {
+				switch checkBackend(context.Background(), backend) {
+				case backendHealthy:
+					backend.IsActive = true
 					e.logger.Debugf("Backend %s is healthy", backend.BackendURL)
-				} else {
+				case backendAuthFailed:
+					// The backend is up, requests fail on the key not the network
+					backend.IsActive = true
+					e.logger.Warnf("Backend %s is reachable but rejected the API key", backend.BackendURL)
+				default:
+					backend.IsActive = false
 					e.logger.Warnf("Backend %s is unhealthy", backend.BackendURL)
 				}
 			}
@@ -27,6 +42,16 @@ func (e *AzureOpenAIEngine) startHealthCheck() {
 	}()
 }
 
+// Close stops the backend health checks
+func (e *AzureOpenAIEngine) Close() {
+	e.stopOnce.Do(func() { close(e.stop) })
+}
+
+// SelectBackend returns the active backend with the fewest open connections
+func (e *AzureOpenAIEngine) SelectBackend() (*BackendConfig, error) {
+	return e.selectLeastLoadedBackend()
+}
+
 func (e *AzureOpenAIEngine) selectLeastLoadedBackend() (*BackendConfig, error) {
 	var selected *BackendConfig
 	minConnections := int64(^uint64(0) >> 1) // Initialize with max possible value
@@ -45,16 +70,68 @@ func (e *AzureOpenAIEngine) selectLeastLoadedBackend() (*BackendConfig, error) {
 	return selected, nil
 }
 
-// https://learn.microsoft.com/en-us/azure/api-management/front-door-api-management?source=post_page-----4dba93c6467d--------------------------------#update-default-origin-group
-func isBackendAvailable(backendURL *url.URL) bool {
+// backendStatus is the outcome of a backend health check
+type backendStatus int
+
+const (
+	backendHealthy backendStatus = iota
+	backendAuthFailed
+	backendUnavailable
+)
+
+// defaultHealthCheckPath lists the resource's models, which every Azure OpenAI resource serves
+const defaultHealthCheckPath = "/openai/models"
+
+// checkBackend requests the backend's health check path with its API key.
+// 401 and 403 mean the backend is reachable but the key is wrong.
+func checkBackend(ctx context.Context, backend *BackendConfig) backendStatus {
 	client := http.Client{
-		Timeout: 2 * time.Second,
+		Transport: backend.Transport(),
+		Timeout:   engine.ProbeTimeout,
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, backend.HealthCheckURL(), nil)
+	if err != nil {
+		logrus.Warnf("Failed to create health check request: %v", err)
+		return backendUnavailable
 	}
-	url := backendURL.String() + "/status-0123456789abcdef"
-	resp, err := client.Get(url)
+	req.Header.Set("Authorization", "Bearer "+backend.APIKey)
+
+	resp, err := client.Do(req)
 	if err != nil {
 		logrus.Warnf("Failed to check backend status: %v", err)
-		return false
+		return backendUnavailable
+	}
+	_ = resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return backendHealthy
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return backendAuthFailed
+	default:
+		return backendUnavailable
+	}
+}
+
+// Probe checks each backend until one is reachable
+func (e *AzureOpenAIEngine) Probe(ctx context.Context) error {
+	for _, backend := range e.backends {
+		if checkBackend(ctx, backend) != backendUnavailable {
+			return nil
+		}
+	}
+	return fmt.Errorf("no azure backend is reachable")
+}
+
+// HealthCheckURL returns the URL probed by health checks, health_check_path
+// or the models list, with the backend's api-version
+func (b *BackendConfig) HealthCheckURL() string {
+	path := b.HealthCheckPath
+	if path == "" {
+		path = defaultHealthCheckPath
 	}
-	return resp.StatusCode == http.StatusOK
+	u := *b.BackendURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.TrimPrefix(path, "/")
+	u.RawQuery = url.Values{"api-version": {b.APIVersion}}.Encode()
+	return u.String()
 }
@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 	"time"
 
@@ -23,6 +24,9 @@ import (
 
 const DEFAULT_REGION = "us-east-1"
 
+// listModelsTimeout bounds each control plane request made by ListModels
+const listModelsTimeout = 10 * time.Second
+
 type globalModels []struct {
 	ID   string `yaml:"id"`
 	Name string `yaml:"name"`
@@ -33,17 +37,37 @@ type BedrockEngine struct {
 	Client  *bedrockruntime.Client
 	Region  string
 
+	// StreamCoalesceWindow merges streamed text deltas emitted within the
+	// window into a single chunk. Zero disables coalescing.
+	StreamCoalesceWindow time.Duration
+	// HTTPSOnlyImages rejects plaintext http:// image URLs in chat messages.
+	HTTPSOnlyImages bool
+	// StreamIdleTimeout aborts a stream when no data arrives within the window. Zero disables it.
+	StreamIdleTimeout time.Duration
+
 	whitelist    []string
 	globalModels globalModels
 	prefix       string
 	awsConfig    aws.Config
 	signer       *v4.Signer
+	// controlPlane is the endpoint of the foundation-models and inference-profiles APIs
+	controlPlane string
+
+	// crossRegionPrefix is the prefix (e.g. "eu") of the system inference
+	// profiles offered alongside the base models
+	crossRegionPrefix string
 }
 
 type bedrockConfig struct {
 	Enabled      bool         `yaml:"enabled"`
 	Region       string       `yaml:"region"`
 	GlobalModels globalModels `yaml:"global_models"`
+	// CrossRegionPrefix overrides the inference profile prefix derived from the region
+	CrossRegionPrefix string `yaml:"cross_region_prefix"`
+
+	StreamCoalesceWindow time.Duration `yaml:"stream_coalesce_window"`
+	HTTPSOnlyImages      bool          `yaml:"https_only_images"`
+	StreamIdleTimeout    time.Duration `yaml:"stream_idle_timeout"`
 }
 
 func NewBedrockEngine(configStr string) (*BedrockEngine, error) {
@@ -74,6 +98,11 @@ func NewBedrockEngine(configStr string) (*BedrockEngine, error) {
 		region = goopConfig.Region
 	}
 
+	crossRegionPrefix := goopConfig.CrossRegionPrefix
+	if crossRegionPrefix == "" {
+		crossRegionPrefix = crossRegionPrefixFor(region)
+	}
+
 	endpoint := "https://bedrock-runtime." + region + ".amazonaws.com"
 	url, err := url.Parse(endpoint)
 	if err != nil {
@@ -89,50 +118,179 @@ func NewBedrockEngine(configStr string) (*BedrockEngine, error) {
 		awsConfig:    cfg,
 		Client:       client,
 		signer:       v4.NewSigner(),
+		controlPlane: "https://bedrock." + region + ".amazonaws.com",
 		Region:       region,
 		globalModels: goopConfig.GlobalModels,
+
+		crossRegionPrefix: crossRegionPrefix,
+
+		StreamCoalesceWindow: goopConfig.StreamCoalesceWindow,
+		HTTPSOnlyImages:      goopConfig.HTTPSOnlyImages,
+		StreamIdleTimeout:    goopConfig.StreamIdleTimeout,
 	}
 	return e, nil
 }
 
+// crossRegionPrefixFor returns the inference profile prefix of region's geography
+func crossRegionPrefixFor(region string) string {
+	switch {
+	case strings.HasPrefix(region, "us-gov-"):
+		return "us-gov"
+	case strings.HasPrefix(region, "us-"):
+		return "us"
+	case strings.HasPrefix(region, "eu-"):
+		return "eu"
+	case strings.HasPrefix(region, "ap-"):
+		return "apac"
+	default:
+		return ""
+	}
+}
+
+// lowerAll lower cases Bedrock's modality names, e.g. "TEXT" -> "text"
+func lowerAll(values []string) []string {
+	lowered := make([]string, 0, len(values))
+	for _, v := range values {
+		lowered = append(lowered, strings.ToLower(v))
+	}
+	return lowered
+}
+
 func (e *BedrockEngine) Name() string {
 	return "bedrock"
 }
 
+// foundationModelSummary is a model in the GET /foundation-models response
+type foundationModelSummary struct {
+	CustomizationsSupported []string `json:"customizationsSupported"`
+	InferenceTypesSupported []string `json:"inferenceTypesSupported"`
+	InputModalities         []string `json:"inputModalities"`
+	ModelArn                string   `json:"modelArn"`
+	ModelId                 string   `json:"modelId"`
+	ModelLifecycle          struct {
+		Status string `json:"status"`
+	} `json:"modelLifecycle"`
+	ModelName                string   `json:"modelName"`
+	OutputModalities         []string `json:"outputModalities"`
+	ProviderName             string   `json:"providerName"`
+	ResponseStreamingSupport bool     `json:"responseStreamingSupported"`
+}
+
 // foundationModelsResponse matches the JSON from calling GET /foundation-models
-// based on the example response you shared.
 type foundationModelsResponse struct {
-	ModelSummaries []struct {
-		CustomizationsSupported []string `json:"customizationsSupported"`
-		InferenceTypesSupported []string `json:"inferenceTypesSupported"`
-		InputModalities         []string `json:"inputModalities"`
-		ModelArn                string   `json:"modelArn"`
-		ModelId                 string   `json:"modelId"`
-		ModelLifecycle          struct {
-			Status string `json:"status"`
-		} `json:"modelLifecycle"`
-		ModelName                string   `json:"modelName"`
-		OutputModalities         []string `json:"outputModalities"`
-		ProviderName             string   `json:"providerName"`
-		ResponseStreamingSupport bool     `json:"responseStreamingSupported"`
-	} `json:"modelSummaries"`
+	ModelSummaries []foundationModelSummary `json:"modelSummaries"`
+}
+
+// inferenceProfilesResponse matches a page of GET /inference-profiles
+type inferenceProfilesResponse struct {
+	InferenceProfileSummaries []struct {
+		InferenceProfileId   string `json:"inferenceProfileId"`
+		InferenceProfileName string `json:"inferenceProfileName"`
+		Status               string `json:"status"`
+	} `json:"inferenceProfileSummaries"`
+	NextToken string `json:"nextToken"`
 }
 
 // ListModels reaches out to the AWS Bedrock foundation-models endpoint,
 // signs the request, and returns a list of openai_types.Model.
 func (e *BedrockEngine) ListModels() ([]openai_schema.Model, error) {
-	endpoint := fmt.Sprintf("https://bedrock.%s.amazonaws.com/foundation-models", e.Region)
-	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, endpoint, nil)
-	if err != nil {
-		logrus.Errorf("failed to create request: %v", err)
+	var fmResp foundationModelsResponse
+	if err := e.getControlPlane("/foundation-models", &fmResp); err != nil {
+		logrus.Errorf("failed to list foundation models: %v", err)
 		return nil, err
 	}
+
+	var models []openai_schema.Model
+	for _, summary := range fmResp.ModelSummaries {
+		models = append(models, summaryModel(summary.ModelId, summary.ModelName, summary))
+	}
+
+	if e.crossRegionPrefix != "" {
+		// Models like Claude 3.5 Sonnet only report ON_DEMAND yet have profiles, so
+		// the profiles themselves are listed rather than guessed from the models
+		profiles, err := e.listInferenceProfiles()
+		if err != nil {
+			logrus.Warnf("Skipping cross-region models, failed to list inference profiles: %v", err)
+		}
+		for _, profile := range profiles.InferenceProfileSummaries {
+			modelID, found := strings.CutPrefix(profile.InferenceProfileId, e.crossRegionPrefix+".")
+			if !found || profile.Status != "ACTIVE" {
+				continue
+			}
+			var summary foundationModelSummary
+			if i := slices.IndexFunc(fmResp.ModelSummaries, func(s foundationModelSummary) bool { return s.ModelId == modelID }); i >= 0 {
+				summary = fmResp.ModelSummaries[i]
+			}
+			models = append(models, summaryModel(profile.InferenceProfileId, profile.InferenceProfileName, summary))
+		}
+	}
+
+	for _, summary := range e.globalModels {
+		// Already listed as a cross-region entry
+		if slices.ContainsFunc(models, func(m openai_schema.Model) bool { return m.ID == "bedrock/"+summary.ID }) {
+			continue
+		}
+		models = append(models, openai_schema.Model{
+			ID:      fmt.Sprintf("bedrock/%s", summary.ID),
+			Name:    summary.Name,
+			Object:  "model",
+			Created: time.Now().Unix(),
+			OwnedBy: "AWS",
+		})
+	}
+
+	for i := range models {
+		addCapabilities(&models[i])
+	}
+
+	logrus.Infof("Found %d models from Bedrock", len(models))
+	return models, nil
+}
+
+// summaryModel returns the model listed as id, described by a foundation model summary
+func summaryModel(id, name string, summary foundationModelSummary) openai_schema.Model {
+	streaming := summary.ResponseStreamingSupport
+	return openai_schema.Model{
+		ID:                 "bedrock/" + id,
+		Name:               name,
+		Object:             "model",
+		Created:            time.Now().Unix(),
+		OwnedBy:            summary.ProviderName,
+		InputModalities:    lowerAll(summary.InputModalities),
+		OutputModalities:   lowerAll(summary.OutputModalities),
+		StreamingSupported: &streaming,
+	}
+}
+
+// listInferenceProfiles returns every page of the region's system defined inference profiles
+func (e *BedrockEngine) listInferenceProfiles() (inferenceProfilesResponse, error) {
+	var profiles inferenceProfilesResponse
+	query := url.Values{"typeEquals": {"SYSTEM_DEFINED"}, "maxResults": {"1000"}}
+	for {
+		var page inferenceProfilesResponse
+		if err := e.getControlPlane("/inference-profiles?"+query.Encode(), &page); err != nil {
+			return profiles, err
+		}
+		profiles.InferenceProfileSummaries = append(profiles.InferenceProfileSummaries, page.InferenceProfileSummaries...)
+		if page.NextToken == "" {
+			return profiles, nil
+		}
+		query.Set("nextToken", page.NextToken)
+	}
+}
+
+// getControlPlane sends a signed GET for path to the control plane and decodes the JSON answer into v
+func (e *BedrockEngine) getControlPlane(path string, v any) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, e.controlPlane+path, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
 	e.SignRequest(req)
 
-	resp, err := http.DefaultClient.Do(req)
+	client := http.Client{Timeout: listModelsTimeout}
+	resp, err := client.Do(req)
 	if err != nil {
-		logrus.Errorf("failed to execute request: %v", err)
-		return nil, err
+		return err
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
@@ -144,38 +302,34 @@ func (e *BedrockEngine) ListModels() ([]openai_schema.Model, error) {
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		logrus.Errorf("Bedrock returned status code %d, body: %s", resp.StatusCode, string(bodyBytes))
-		return nil, fmt.Errorf("bedrock returned status code %d", resp.StatusCode)
+		return fmt.Errorf("bedrock returned status code %d", resp.StatusCode)
 	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
 
-	var fmResp foundationModelsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&fmResp); err != nil {
-		logrus.Errorf("failed to decode foundation-models response: %v", err)
-		return nil, err
+// Probe sends a signed request to the foundation-models endpoint. Any answer
+// below 500 means Bedrock is reachable, even if the credentials are rejected.
+func (e *BedrockEngine) Probe(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.foundationModelsURL(), nil)
+	if err != nil {
+		return fmt.Errorf("error creating probe request: %w", err)
 	}
+	e.SignRequest(req)
 
-	var models []openai_schema.Model
-	for _, summary := range fmResp.ModelSummaries {
-		models = append(models, openai_schema.Model{
-			ID:      fmt.Sprintf("bedrock/%s", summary.ModelId),
-			Name:    summary.ModelName,
-			Object:  "model",
-			Created: time.Now().Unix(),
-			OwnedBy: summary.ProviderName,
-		})
+	client := http.Client{Timeout: engine.ProbeTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
 	}
-
-	for _, summary := range e.globalModels {
-		models = append(models, openai_schema.Model{
-			ID:      fmt.Sprintf("bedrock/%s", summary.ID),
-			Name:    summary.Name,
-			Object:  "model",
-			Created: time.Now().Unix(),
-			OwnedBy: "AWS",
-		})
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("bedrock returned status code %d", resp.StatusCode)
 	}
+	return nil
+}
 
-	logrus.Infof("Found %d models from Bedrock", len(models))
-	return models, nil
+func (e *BedrockEngine) foundationModelsURL() string {
+	return e.controlPlane + "/foundation-models"
 }
 
 func (e *BedrockEngine) IsAllowedPath(path string) bool {
@@ -0,0 +1,160 @@
+package bedrock
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/robertprast/goop/pkg/openai_schema"
+)
+
+func TestCrossRegionPrefixFor(t *testing.T) {
+	tests := map[string]string{
+		"us-east-1":      "us",
+		"us-west-2":      "us",
+		"us-gov-west-1":  "us-gov",
+		"us-gov-east-1":  "us-gov",
+		"eu-central-1":   "eu",
+		"eu-west-3":      "eu",
+		"ap-northeast-1": "apac",
+		"ap-southeast-2": "apac",
+		"ca-central-1":   "",
+		"sa-east-1":      "",
+		"":               "",
+	}
+	for region, want := range tests {
+		if got := crossRegionPrefixFor(region); got != want {
+			t.Errorf("crossRegionPrefixFor(%q) = %q, want %q", region, got, want)
+		}
+	}
+}
+
+func TestNewBedrockEngineCrossRegionPrefix(t *testing.T) {
+	// Keep the SDK from reading the machine's AWS config
+	t.Setenv("AWS_CONFIG_FILE", "/nonexistent")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/nonexistent")
+
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{"derived from region", "enabled: true\nregion: eu-west-1", "eu"},
+		{"gov region", "enabled: true\nregion: us-gov-west-1", "us-gov"},
+		{"override", "enabled: true\nregion: eu-west-1\ncross_region_prefix: global", "global"},
+		{"override for an unmapped region", "enabled: true\nregion: ca-central-1\ncross_region_prefix: us", "us"},
+		{"unmapped region", "enabled: true\nregion: ca-central-1", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := NewBedrockEngine(tt.config)
+			if err != nil {
+				t.Fatalf("NewBedrockEngine() error = %v", err)
+			}
+			if e.crossRegionPrefix != tt.want {
+				t.Errorf("crossRegionPrefix = %q, want %q", e.crossRegionPrefix, tt.want)
+			}
+		})
+	}
+}
+
+func TestListModelsIncludesInferenceProfiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			t.Errorf("%s request isn't signed", r.URL.Path)
+		}
+		switch {
+		case r.URL.Path == "/foundation-models":
+			_, _ = io.WriteString(w, `{"modelSummaries":[
+				{"modelId":"anthropic.claude-3-5-sonnet-20240620-v1:0","modelName":"Claude 3.5 Sonnet","providerName":"Anthropic","inferenceTypesSupported":["ON_DEMAND"],"inputModalities":["TEXT","IMAGE"],"outputModalities":["TEXT"],"responseStreamingSupported":true},
+				{"modelId":"amazon.titan-embed-text-v2:0","modelName":"Titan Text Embeddings V2","providerName":"Amazon","inferenceTypesSupported":["ON_DEMAND"],"inputModalities":["TEXT"],"outputModalities":["EMBEDDING"]}
+			]}`)
+		case r.URL.Path == "/inference-profiles" && r.URL.Query().Get("nextToken") == "":
+			if r.URL.Query().Get("typeEquals") != "SYSTEM_DEFINED" {
+				t.Errorf("inference profiles query = %q, want system defined profiles", r.URL.RawQuery)
+			}
+			_, _ = io.WriteString(w, `{"inferenceProfileSummaries":[
+				{"inferenceProfileId":"us.anthropic.claude-3-5-sonnet-20240620-v1:0","inferenceProfileName":"US Anthropic Claude 3.5 Sonnet","status":"ACTIVE"},
+				{"inferenceProfileId":"eu.anthropic.claude-3-5-sonnet-20240620-v1:0","inferenceProfileName":"EU Anthropic Claude 3.5 Sonnet","status":"ACTIVE"}
+			],"nextToken":"page2"}`)
+		case r.URL.Path == "/inference-profiles":
+			_, _ = io.WriteString(w, `{"inferenceProfileSummaries":[
+				{"inferenceProfileId":"us.anthropic.claude-3-7-sonnet-20250219-v1:0","inferenceProfileName":"US Anthropic Claude 3.7 Sonnet","status":"ACTIVE"}
+			]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	e := &BedrockEngine{
+		Region:            "us-east-1",
+		controlPlane:      server.URL,
+		crossRegionPrefix: "us",
+		signer:            v4.NewSigner(),
+		awsConfig: aws.Config{Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+		})},
+		globalModels: globalModels{{ID: "us.anthropic.claude-3-7-sonnet-20250219-v1:0", Name: "Claude 3.7 Sonnet"}},
+	}
+	models, err := e.ListModels()
+	if err != nil {
+		t.Fatalf("ListModels() error = %v", err)
+	}
+
+	byID := make(map[string]openai_schema.Model)
+	var ids []string
+	for _, m := range models {
+		byID[m.ID] = m
+		ids = append(ids, m.ID)
+	}
+	want := []string{
+		"bedrock/anthropic.claude-3-5-sonnet-20240620-v1:0",
+		"bedrock/amazon.titan-embed-text-v2:0",
+		"bedrock/us.anthropic.claude-3-5-sonnet-20240620-v1:0",
+		"bedrock/us.anthropic.claude-3-7-sonnet-20250219-v1:0",
+	}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("model ids = %v, want %v", ids, want)
+	}
+
+	// The ON_DEMAND only model's profile is described by its foundation model
+	profile := byID["bedrock/us.anthropic.claude-3-5-sonnet-20240620-v1:0"]
+	if profile.OwnedBy != "Anthropic" || !reflect.DeepEqual(profile.InputModalities, []string{"text", "image"}) || profile.StreamingSupported == nil || !*profile.StreamingSupported {
+		t.Errorf("profile model = %+v, want the foundation model's owner, modalities and streaming", profile)
+	}
+}
+
+func TestListModelsWithoutInferenceProfiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/foundation-models" {
+			http.Error(w, `{"message":"not authorized to perform bedrock:ListInferenceProfiles"}`, http.StatusForbidden)
+			return
+		}
+		_, _ = io.WriteString(w, `{"modelSummaries":[{"modelId":"anthropic.claude-3-5-sonnet-20240620-v1:0","modelName":"Claude 3.5 Sonnet"}]}`)
+	}))
+	defer server.Close()
+
+	e := &BedrockEngine{
+		Region:            "us-east-1",
+		controlPlane:      server.URL,
+		crossRegionPrefix: "us",
+		signer:            v4.NewSigner(),
+		awsConfig: aws.Config{Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+		})},
+	}
+	// Base models are still listed when the profiles can't be
+	models, err := e.ListModels()
+	if err != nil {
+		t.Fatalf("ListModels() error = %v", err)
+	}
+	if len(models) != 1 || models[0].ID != "bedrock/anthropic.claude-3-5-sonnet-20240620-v1:0" {
+		t.Errorf("models = %+v, want only the base model", models)
+	}
+}
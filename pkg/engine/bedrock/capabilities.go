@@ -0,0 +1,63 @@
+package bedrock
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/robertprast/goop/pkg/openai_schema"
+)
+
+// modelLimits are the documented limits of a model family. The model summary
+// doesn't carry them, nor whether the model supports tool use.
+type modelLimits struct {
+	contextLength   int
+	maxOutputTokens int
+	tools           bool
+}
+
+// knownModels maps a model id fragment to its family's limits. Cross-region
+// ids match too since the fragment is searched anywhere in the id.
+var knownModels = []struct {
+	fragment string
+	limits   modelLimits
+}{
+	{"anthropic.claude-3-5-sonnet", modelLimits{200000, 8192, true}},
+	{"anthropic.claude-3-5-haiku", modelLimits{200000, 8192, true}},
+	{"anthropic.claude-3-opus", modelLimits{200000, 4096, true}},
+	{"anthropic.claude-3-sonnet", modelLimits{200000, 4096, true}},
+	{"anthropic.claude-3-haiku", modelLimits{200000, 4096, true}},
+	{"amazon.nova-pro", modelLimits{300000, 5120, true}},
+	{"amazon.nova-lite", modelLimits{300000, 5120, true}},
+	{"amazon.nova-micro", modelLimits{128000, 5120, true}},
+}
+
+// addCapabilities fills the model's capabilities from its modalities and
+// streaming support, and its limits from knownModels
+func addCapabilities(m *openai_schema.Model) {
+	var capabilities []string
+	if m.StreamingSupported != nil && *m.StreamingSupported {
+		capabilities = append(capabilities, "streaming")
+	}
+	if slices.Contains(m.InputModalities, "image") && slices.Contains(m.OutputModalities, "text") {
+		capabilities = append(capabilities, "vision")
+	}
+	if slices.Contains(m.OutputModalities, "image") {
+		capabilities = append(capabilities, "image_generation")
+	}
+	if slices.Contains(m.OutputModalities, "embedding") {
+		capabilities = append(capabilities, "embeddings")
+	}
+
+	for _, known := range knownModels {
+		if !strings.Contains(m.ID, known.fragment) {
+			continue
+		}
+		m.ContextLength = &known.limits.contextLength
+		m.MaxOutputTokens = &known.limits.maxOutputTokens
+		if known.limits.tools {
+			capabilities = append(capabilities, "tools")
+		}
+		break
+	}
+	m.Capabilities = capabilities
+}
@@ -9,14 +9,30 @@ type CustomContentBlockDeltaEvent struct {
 	Delta             json.RawMessage `json:"delta"`
 }
 
-type TextDelta struct {
-	Value string `json:"text"`
+// ContentBlockDelta is the delta of a contentBlockDelta event, either text
+// or a fragment of a tool call's JSON input
+type ContentBlockDelta struct {
+	Text    *string       `json:"text,omitempty"`
+	ToolUse *ToolUseDelta `json:"toolUse,omitempty"`
 }
 
 type ToolUseDelta struct {
 	Value string `json:"input"`
 }
 
+// ContentBlockStartEvent opens a content block, tool use blocks carry the tool's ID and name
+type ContentBlockStartEvent struct {
+	ContentBlockIndex int `json:"contentBlockIndex"`
+	Start             struct {
+		ToolUse *ToolUseStart `json:"toolUse,omitempty"`
+	} `json:"start"`
+}
+
+type ToolUseStart struct {
+	ToolUseId string `json:"toolUseId"`
+	Name      string `json:"name"`
+}
+
 type Response struct {
 	Metrics struct {
 		LatencyMs int `json:"latencyMs"`
@@ -28,11 +44,23 @@ type Response struct {
 		} `json:"message"`
 	} `json:"output"`
 	StopReason string `json:"stopReason"`
-	Usage      struct {
-		InputTokens  int `json:"inputTokens"`
-		OutputTokens int `json:"outputTokens"`
-		TotalTokens  int `json:"totalTokens"`
-	} `json:"usage"`
+	Usage      Usage  `json:"usage"`
+}
+
+type Usage struct {
+	InputTokens  int `json:"inputTokens"`
+	OutputTokens int `json:"outputTokens"`
+	TotalTokens  int `json:"totalTokens"`
+}
+
+// MessageStopEvent ends a converse stream's message with the reason generation stopped
+type MessageStopEvent struct {
+	StopReason string `json:"stopReason"`
+}
+
+// MetadataEvent is the final converse-stream event carrying token usage
+type MetadataEvent struct {
+	Usage Usage `json:"usage"`
 }
 
 type ContentItem struct {
@@ -41,18 +69,9 @@ type ContentItem struct {
 }
 
 type ToolUse struct {
-	Input     map[string]string `json:"input"`
-	Name      string            `json:"name"`
-	ToolUseId string            `json:"toolUseId"`
-}
-
-type ToolCall struct {
-	ID       string `json:"id"`
-	Type     string `json:"type"`
-	Function struct {
-		Name      string `json:"name"`
-		Arguments string `json:"arguments"`
-	} `json:"function"`
+	Input     json.RawMessage `json:"input"`
+	Name      string          `json:"name"`
+	ToolUseId string          `json:"toolUseId"`
 }
 
 type Request struct {
@@ -68,9 +87,21 @@ type Message struct {
 }
 
 type ContentBlock struct {
-	Text   string `json:"text,omitempty"`
-	Format string `json:"format,omitempty"`
-	Image  *Image `json:"image,omitempty"`
+	Text       string      `json:"text,omitempty"`
+	Format     string      `json:"format,omitempty"`
+	Image      *Image      `json:"image,omitempty"`
+	ToolUse    *ToolUse    `json:"toolUse,omitempty"`
+	ToolResult *ToolResult `json:"toolResult,omitempty"`
+}
+
+// ToolResult answers the toolUse block with the same ToolUseId
+type ToolResult struct {
+	ToolUseId string              `json:"toolUseId"`
+	Content   []ToolResultContent `json:"content"`
+}
+
+type ToolResultContent struct {
+	Text string `json:"text"`
 }
 
 type SystemMessage struct {
@@ -88,6 +119,7 @@ type ImageSource struct {
 type InferenceConfig struct {
 	Temperature   float64  `json:"temperature,omitempty"`
 	TopP          float64  `json:"top_p,omitempty"`
+	TopK          int      `json:"top_k,omitempty"`
 	MaxTokens     int      `json:"max_tokens,omitempty"`
 	StopSequences []string `json:"stop_sequences,omitempty"`
 }
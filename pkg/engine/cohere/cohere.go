@@ -0,0 +1,99 @@
+package cohere
+
+import (
+	"context"
+	"fmt"
+	"github.com/robertprast/goop/pkg/openai_schema"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/robertprast/goop/pkg/engine"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+const DEFAULT_BASE_URL = "https://api.cohere.com"
+
+type cohereConfig struct {
+	APIKey  string `yaml:"api_key"`
+	BaseUrl string `yaml:"base_url"`
+}
+
+// CohereEngine proxies to the Cohere API
+type CohereEngine struct {
+	Backend *url.URL
+	APIKey  string
+
+	whitelist []string
+	prefix    string
+	logger    *logrus.Entry
+}
+
+func NewCohereEngine(configStr string) (*CohereEngine, error) {
+	var config cohereConfig
+	if err := yaml.Unmarshal([]byte(configStr), &config); err != nil {
+		logrus.Errorf("Error parsing Cohere config: %v", err)
+		return nil, fmt.Errorf("error parsing Cohere config: %w", err)
+	}
+	if config.APIKey == "" {
+		return nil, fmt.Errorf("cohere api_key is required")
+	}
+	if config.BaseUrl == "" {
+		config.BaseUrl = DEFAULT_BASE_URL
+	}
+
+	parsedUrl, err := url.Parse(strings.TrimSuffix(config.BaseUrl, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing Cohere base_url: %w", err)
+	}
+
+	return &CohereEngine{
+		Backend:   parsedUrl,
+		APIKey:    config.APIKey,
+		whitelist: []string{"/v2/rerank", "/v2/chat", "/v2/embed", "/v1/models"},
+		prefix:    "/cohere",
+		logger:    logrus.WithField("engine", "cohere"),
+	}, nil
+}
+
+func (e *CohereEngine) Name() string {
+	return "cohere"
+}
+
+func (e *CohereEngine) ListModels() ([]openai_schema.Model, error) {
+	return []openai_schema.Model{}, nil
+}
+
+// Probe lists the models available to the API key
+func (e *CohereEngine) Probe(ctx context.Context) error {
+	header := http.Header{"Authorization": {"Bearer " + e.APIKey}}
+	return engine.ProbeURL(ctx, nil, e.Backend.String()+"/v1/models", header)
+}
+
+func (e *CohereEngine) IsAllowedPath(path string) bool {
+	for _, allowedPath := range e.whitelist {
+		if strings.HasPrefix(path, e.prefix+allowedPath) {
+			return true
+		}
+	}
+	e.logger.Warnf("Path %s is not allowed", path)
+	return false
+}
+
+func (e *CohereEngine) ModifyRequest(r *http.Request) {
+	r.URL.Path = strings.TrimPrefix(r.URL.Path, e.prefix)
+	r.Host = e.Backend.Host
+	r.URL.Scheme = e.Backend.Scheme
+	r.URL.Host = e.Backend.Host
+
+	r.Header.Set("Authorization", "Bearer "+e.APIKey)
+	e.logger.Infof("Modified request for backend: %s", e.Backend)
+}
+
+func (e *CohereEngine) ResponseCallback(resp *http.Response, body io.Reader) {
+	id, _ := resp.Request.Context().Value(engine.RequestId).(string)
+	logrus.Infof("Response [HTTP %d] Correlation ID: %s Body Length: %d\n",
+		resp.StatusCode, id, resp.ContentLength)
+}
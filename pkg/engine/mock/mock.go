@@ -0,0 +1,67 @@
+package mock
+
+import (
+	"context"
+	"fmt"
+	"github.com/robertprast/goop/pkg/openai_schema"
+	"io"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+type mockConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Response string `yaml:"response"`
+}
+
+// MockEngine serves deterministic chat completions without calling any
+// upstream, for local development and client integration tests
+type MockEngine struct {
+	// Response is returned for every request. When empty the last user message is echoed back.
+	Response string
+}
+
+func NewMockEngine(configStr string) (*MockEngine, error) {
+	var config mockConfig
+	if err := yaml.Unmarshal([]byte(configStr), &config); err != nil {
+		logrus.Errorf("Error parsing mock config: %v", err)
+		return nil, fmt.Errorf("error parsing mock config: %w", err)
+	}
+	if !config.Enabled {
+		return nil, fmt.Errorf("mock engine is disabled")
+	}
+	return &MockEngine{Response: config.Response}, nil
+}
+
+func (e *MockEngine) Name() string {
+	return "mock"
+}
+
+func (e *MockEngine) ListModels() ([]openai_schema.Model, error) {
+	return []openai_schema.Model{
+		{
+			ID:               "mock/echo",
+			Name:             "Mock echo",
+			Object:           "model",
+			OwnedBy:          "goop",
+			InputModalities:  []string{"text"},
+			OutputModalities: []string{"text"},
+		},
+	}, nil
+}
+
+// Probe always succeeds, the mock engine has no upstream
+func (e *MockEngine) Probe(ctx context.Context) error {
+	return nil
+}
+
+// IsAllowedPath rejects every path, the mock engine is only served through the OpenAI proxy
+func (e *MockEngine) IsAllowedPath(path string) bool {
+	return false
+}
+
+func (e *MockEngine) ModifyRequest(r *http.Request) {}
+
+func (e *MockEngine) ResponseCallback(resp *http.Response, body io.Reader) {}
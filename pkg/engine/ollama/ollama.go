@@ -0,0 +1,145 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/robertprast/goop/pkg/openai_schema"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/robertprast/goop/pkg/engine"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+const DEFAULT_BASE_URL = "http://localhost:11434"
+
+// listModelsTimeout bounds the /api/tags request made by ListModels
+const listModelsTimeout = 10 * time.Second
+
+type ollamaConfig struct {
+	BaseUrl             string        `yaml:"base_url"`
+	StreamIdleTimeout   time.Duration `yaml:"stream_idle_timeout"`
+	StreamFlushBytes    int           `yaml:"stream_flush_bytes"`
+	StreamFlushInterval time.Duration `yaml:"stream_flush_interval"`
+}
+
+// OllamaEngine proxies to a local Ollama server. Ollama doesn't require auth.
+type OllamaEngine struct {
+	Backend *url.URL
+	// StreamIdleTimeout aborts a stream when no data arrives within the window. Zero disables it.
+	StreamIdleTimeout time.Duration
+	// StreamFlushBytes and StreamFlushInterval coalesce streamed chunks before
+	// flushing them to the client. Zero flushes every chunk.
+	StreamFlushBytes    int
+	StreamFlushInterval time.Duration
+
+	whitelist []string
+	prefix    string
+	logger    *logrus.Entry
+}
+
+// tagsResponse is the body of Ollama's /api/tags endpoint
+type tagsResponse struct {
+	Models []struct {
+		Name       string `json:"name"`
+		Model      string `json:"model"`
+		ModifiedAt string `json:"modified_at"`
+	} `json:"models"`
+}
+
+func NewOllamaEngine(configStr string) (*OllamaEngine, error) {
+	var config ollamaConfig
+	if err := yaml.Unmarshal([]byte(configStr), &config); err != nil {
+		logrus.Errorf("Error parsing Ollama config: %v", err)
+		return nil, fmt.Errorf("error parsing Ollama config: %w", err)
+	}
+	if config.BaseUrl == "" {
+		config.BaseUrl = DEFAULT_BASE_URL
+	}
+
+	parsedUrl, err := url.Parse(strings.TrimSuffix(config.BaseUrl, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing Ollama base_url: %w", err)
+	}
+
+	return &OllamaEngine{
+		Backend:             parsedUrl,
+		StreamIdleTimeout:   config.StreamIdleTimeout,
+		StreamFlushBytes:    config.StreamFlushBytes,
+		StreamFlushInterval: config.StreamFlushInterval,
+		whitelist:           []string{"/v1/chat/completions", "/v1/completions", "/v1/models", "/v1/embeddings", "/api/"},
+		prefix:              "/ollama",
+		logger:              logrus.WithField("engine", "ollama"),
+	}, nil
+}
+
+func (e *OllamaEngine) Name() string {
+	return "ollama"
+}
+
+// ListModels returns the models pulled on the Ollama server
+func (e *OllamaEngine) ListModels() ([]openai_schema.Model, error) {
+	client := http.Client{Timeout: listModelsTimeout}
+	resp, err := client.Get(e.Backend.String() + "/api/tags")
+	if err != nil {
+		return nil, fmt.Errorf("error listing Ollama models: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error listing Ollama models: status %d", resp.StatusCode)
+	}
+
+	var tags tagsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("error decoding Ollama models: %w", err)
+	}
+
+	models := make([]openai_schema.Model, 0, len(tags.Models))
+	for _, m := range tags.Models {
+		models = append(models, openai_schema.Model{
+			ID:      "ollama/" + m.Name,
+			Name:    m.Name,
+			Object:  "model",
+			OwnedBy: "ollama",
+		})
+	}
+	return models, nil
+}
+
+// Probe requests the server's version, which needs no model to be loaded
+func (e *OllamaEngine) Probe(ctx context.Context) error {
+	return engine.ProbeURL(ctx, nil, e.Backend.String()+"/api/version", nil)
+}
+
+func (e *OllamaEngine) IsAllowedPath(path string) bool {
+	for _, allowedPath := range e.whitelist {
+		if strings.HasPrefix(path, e.prefix+allowedPath) {
+			return true
+		}
+	}
+	e.logger.Warnf("Path %s is not allowed", path)
+	return false
+}
+
+func (e *OllamaEngine) ModifyRequest(r *http.Request) {
+	r.URL.Path = strings.TrimPrefix(r.URL.Path, e.prefix)
+	r.Host = e.Backend.Host
+	r.URL.Scheme = e.Backend.Scheme
+	r.URL.Host = e.Backend.Host
+
+	// Ollama ignores credentials, don't forward the client's
+	r.Header.Del("Authorization")
+	e.logger.Infof("Modified request for backend: %s", e.Backend)
+}
+
+func (e *OllamaEngine) ResponseCallback(resp *http.Response, body io.Reader) {
+	id, _ := resp.Request.Context().Value(engine.RequestId).(string)
+	logrus.Infof("Response [HTTP %d] Correlation ID: %s Body Length: %d\n",
+		resp.StatusCode, id, resp.ContentLength)
+}
@@ -0,0 +1,78 @@
+package openai
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/robertprast/goop/pkg/engine"
+)
+
+// startHealthChecks probes every backend that has a health_check_interval
+// set and marks it unhealthy while its models endpoint can't be reached
+func (e *OpenAIEngine) startHealthChecks() {
+	for _, backend := range e.backends {
+		if backend.HealthCheckInterval > 0 {
+			go e.healthCheck(backend)
+		}
+	}
+}
+
+func (e *OpenAIEngine) healthCheck(backend *BackendConfig) {
+	ticker := time.NewTicker(backend.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-ticker.C:
+		}
+		healthy := e.isBackendAvailable(backend)
+		wasHealthy := atomic.SwapInt32(&backend.unhealthy, boolToInt32(!healthy)) == 0
+		switch {
+		case healthy && !wasHealthy:
+			e.logger.Infof("Backend %s is healthy again", backend.BackendURL)
+		case !healthy && wasHealthy:
+			e.logger.Warnf("Backend %s is unhealthy", backend.BackendURL)
+		}
+	}
+}
+
+// Close stops the backend health checks
+func (e *OpenAIEngine) Close() {
+	e.stopOnce.Do(func() { close(e.stop) })
+}
+
+// isBackendAvailable lists the backend's models. Any answer below 500 means
+// the backend is up, even if the key is rejected.
+func (e *OpenAIEngine) isBackendAvailable(backend *BackendConfig) bool {
+	if err := probeBackend(context.Background(), backend); err != nil {
+		e.logger.Warnf("Failed to check backend status: %v", err)
+		return false
+	}
+	return true
+}
+
+// Probe lists the models of each backend until one answers
+func (e *OpenAIEngine) Probe(ctx context.Context) error {
+	var err error
+	for _, backend := range e.backends {
+		if err = probeBackend(ctx, backend); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func probeBackend(ctx context.Context, backend *BackendConfig) error {
+	header := http.Header{"Authorization": {"Bearer " + backend.APIKey}}
+	return engine.ProbeURL(ctx, backend.Transport(), backend.ModelsURL(), header)
+}
+
+func boolToInt32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
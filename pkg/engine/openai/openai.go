@@ -7,8 +7,12 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/robertprast/goop/pkg/engine"
+	"github.com/robertprast/goop/pkg/utils"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
@@ -17,46 +21,213 @@ type BackendConfig struct {
 	BaseUrl    string `yaml:"base_url"`
 	APIKey     string `yaml:"api_key"`
 	APIVersion string `yaml:"api_version"`
+	// StreamIdleTimeout aborts a stream when no data arrives within the window. Zero disables it.
+	StreamIdleTimeout time.Duration `yaml:"stream_idle_timeout"`
+	// StreamFlushBytes and StreamFlushInterval coalesce streamed chunks before
+	// flushing them to the client. Zero flushes every chunk.
+	StreamFlushBytes    int           `yaml:"stream_flush_bytes"`
+	StreamFlushInterval time.Duration `yaml:"stream_flush_interval"`
+	// HealthCheckInterval probes the backend's models endpoint this often and
+	// skips the backend while it's down. Zero disables health checks.
+	HealthCheckInterval time.Duration `yaml:"health_check_interval"`
+	// TLS configures a private CA or client certificate for the backend
+	TLS        utils.TLSConfig `yaml:"tls"`
 	BackendURL *url.URL
+
+	unhealthy int32
+	transport http.RoundTripper
+}
+
+// CompatibleConfig configures one OpenAI compatible provider (Mistral, Groq,
+// Together, DeepSeek, ...) under the `openai_compatible` engine list
+type CompatibleConfig struct {
+	Name    string `yaml:"name"`
+	BaseUrl string `yaml:"base_url"`
+	APIKey  string `yaml:"api_key"`
+	// Prefix routes `<prefix>/<model>` models and `/<prefix>/...` paths, defaults to Name
+	Prefix              string          `yaml:"prefix"`
+	StreamIdleTimeout   time.Duration   `yaml:"stream_idle_timeout"`
+	HealthCheckInterval time.Duration   `yaml:"health_check_interval"`
+	TLS                 utils.TLSConfig `yaml:"tls"`
+	StreamFlushBytes    int             `yaml:"stream_flush_bytes"`
+	StreamFlushInterval time.Duration   `yaml:"stream_flush_interval"`
 }
 
 type OpenAIEngine struct {
-	backend   *BackendConfig
+	name      string
+	backends  []*BackendConfig
+	next      uint64
 	whitelist []string
 	prefix    string
 	logger    *logrus.Entry
+	stop      chan struct{}
+	stopOnce  sync.Once
 }
 
+// NewOpenAIEngineWithConfig creates the openai engine from either a single
+// backend or a list of backends, which requests are spread across round-robin
 func NewOpenAIEngineWithConfig(configStr string) (*OpenAIEngine, error) {
-	var backend BackendConfig
-
-	// Unmarshal YAML into slice of BackendConfig
-	if err := yaml.Unmarshal([]byte(configStr), &backend); err != nil {
+	configs, err := parseBackendConfigs(configStr)
+	if err != nil {
 		logrus.Errorf("Error parsing OpenAI config: %v", err)
 		return nil, fmt.Errorf("error parsing OpenAI config: %w", err)
 	}
 
-	if backend.BaseUrl == "" || backend.APIKey == "" {
-		return nil, fmt.Errorf("error parsing OpenAI config: missing base_url or api_key")
+	var backends []*BackendConfig
+	for i := range configs {
+		backend := configs[i]
+		if backend.BaseUrl == "" || backend.APIKey == "" {
+			return nil, fmt.Errorf("error parsing OpenAI config: backend at index %d is missing base_url or api_key", i)
+		}
+		parsedUrl, err := url.Parse(backend.BaseUrl)
+		if err != nil {
+			return nil, err
+		}
+		backend.BackendURL = parsedUrl
+		if backend.transport, err = utils.NewTransport(backend.TLS); err != nil {
+			return nil, fmt.Errorf("error parsing OpenAI config: backend at index %d: %w", i, err)
+		}
+		backends = append(backends, &backend)
+	}
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("error parsing OpenAI config: no backends configured")
+	}
+
+	e := &OpenAIEngine{
+		name:      "openai",
+		backends:  backends,
+		whitelist: []string{"/v1/chat/completions", "/v1/completions", "/v1/models", "/v1/moderations", "/v1/responses"},
+		prefix:    "/openai",
+		logger:    logrus.WithField("e", "openai"),
+		stop:      make(chan struct{}),
+	}
+	e.startHealthChecks()
+	return e, nil
+}
+
+// parseBackendConfigs accepts a list of backends or a single backend map
+func parseBackendConfigs(configStr string) ([]BackendConfig, error) {
+	var configs []BackendConfig
+	if err := yaml.Unmarshal([]byte(configStr), &configs); err == nil {
+		return configs, nil
 	}
 
-	parsedUrl, err := url.Parse(backend.BaseUrl)
+	var config BackendConfig
+	if err := yaml.Unmarshal([]byte(configStr), &config); err != nil {
+		return nil, err
+	}
+	return []BackendConfig{config}, nil
+}
+
+// ParseCompatibleConfigs parses the `openai_compatible` engine list
+func ParseCompatibleConfigs(configStr string) ([]CompatibleConfig, error) {
+	var configs []CompatibleConfig
+	if err := yaml.Unmarshal([]byte(configStr), &configs); err != nil {
+		return nil, fmt.Errorf("error parsing openai_compatible config: %w", err)
+	}
+	for i, config := range configs {
+		if config.Name == "" {
+			return nil, fmt.Errorf("openai_compatible backend at index %d is missing a name", i)
+		}
+		if config.Prefix == "" {
+			configs[i].Prefix = config.Name
+		}
+	}
+	return configs, nil
+}
+
+// NewOpenAICompatibleEngine creates an OpenAI passthrough engine for a compatible provider
+func NewOpenAICompatibleEngine(config CompatibleConfig) (*OpenAIEngine, error) {
+	if config.BaseUrl == "" || config.APIKey == "" {
+		return nil, fmt.Errorf("error parsing %s config: missing base_url or api_key", config.Name)
+	}
+	parsedUrl, err := url.Parse(config.BaseUrl)
 	if err != nil {
 		return nil, err
 	}
-	backend.BackendURL = parsedUrl
+	if config.Prefix == "" {
+		config.Prefix = config.Name
+	}
+	transport, err := utils.NewTransport(config.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s config: %w", config.Name, err)
+	}
 
 	e := &OpenAIEngine{
-		backend:   &backend,
+		name: config.Name,
+		backends: []*BackendConfig{{
+			BaseUrl:             config.BaseUrl,
+			APIKey:              config.APIKey,
+			StreamIdleTimeout:   config.StreamIdleTimeout,
+			StreamFlushBytes:    config.StreamFlushBytes,
+			StreamFlushInterval: config.StreamFlushInterval,
+			HealthCheckInterval: config.HealthCheckInterval,
+			TLS:                 config.TLS,
+			BackendURL:          parsedUrl,
+			transport:           transport,
+		}},
 		whitelist: []string{"/v1/chat/completions", "/v1/completions", "/v1/models"},
-		prefix:    "/openai",
-		logger:    logrus.WithField("e", "openai"),
+		prefix:    "/" + config.Prefix,
+		logger:    logrus.WithField("e", config.Name),
+		stop:      make(chan struct{}),
 	}
+	e.startHealthChecks()
 	return e, nil
 }
 
 func (e *OpenAIEngine) Name() string {
-	return "openai"
+	return e.name
+}
+
+// SelectBackend returns the next healthy backend in round-robin order. When
+// every backend is unhealthy the plain round-robin pick is returned.
+func (e *OpenAIEngine) SelectBackend() *BackendConfig {
+	n := atomic.AddUint64(&e.next, 1) - 1
+	for i := range e.backends {
+		backend := e.backends[(n+uint64(i))%uint64(len(e.backends))]
+		if atomic.LoadInt32(&backend.unhealthy) == 0 {
+			return backend
+		}
+	}
+	e.logger.Warn("No healthy backends, using an unhealthy one")
+	return e.backends[n%uint64(len(e.backends))]
+}
+
+// Transport returns the round tripper for requests to the backend
+func (b *BackendConfig) Transport() http.RoundTripper {
+	if b.transport == nil {
+		return http.DefaultTransport
+	}
+	return b.transport
+}
+
+// Transport returns the round tripper for requests rewritten by ModifyRequest,
+// using the TLS settings of the backend the request was sent to
+func (e *OpenAIEngine) Transport() http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		for _, backend := range e.backends {
+			if backend.BackendURL.Host == r.URL.Host {
+				return backend.Transport().RoundTrip(r)
+			}
+		}
+		return http.DefaultTransport.RoundTrip(r)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// ChatCompletionsURL returns the backend's chat completions endpoint
+func (b *BackendConfig) ChatCompletionsURL() string {
+	return strings.TrimSuffix(b.BaseUrl, "/") + "/chat/completions"
+}
+
+// ModelsURL returns the backend's model list endpoint
+func (b *BackendConfig) ModelsURL() string {
+	return strings.TrimSuffix(b.BaseUrl, "/") + "/models"
 }
 
 func (e *OpenAIEngine) ListModels() ([]openai_schema.Model, error) {
@@ -74,14 +245,15 @@ func (e *OpenAIEngine) IsAllowedPath(path string) bool {
 }
 
 func (e *OpenAIEngine) ModifyRequest(r *http.Request) {
+	backend := e.SelectBackend()
 
 	r.URL.Path = strings.TrimPrefix(r.URL.Path, e.prefix)
-	r.Host = e.backend.BackendURL.Host
-	r.URL.Scheme = e.backend.BackendURL.Scheme
-	r.URL.Host = e.backend.BackendURL.Host
+	r.Host = backend.BackendURL.Host
+	r.URL.Scheme = backend.BackendURL.Scheme
+	r.URL.Host = backend.BackendURL.Host
 
-	r.Header.Set("Authorization", "Bearer "+e.backend.APIKey)
-	e.logger.Infof("Modified request for backend: %s", e.backend.BackendURL)
+	r.Header.Set("Authorization", "Bearer "+backend.APIKey)
+	e.logger.Infof("Modified request for backend: %s", backend.BackendURL)
 }
 
 func (e *OpenAIEngine) ResponseCallback(resp *http.Response, body io.Reader) {
@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ProbeTimeout bounds a single probe request
+const ProbeTimeout = 2 * time.Second
+
+// Prober is implemented by engines that can check their upstream is reachable
+type Prober interface {
+	// Probe requests a cheap upstream endpoint and returns an error when it
+	// can't be reached or answers with a server error
+	Probe(ctx context.Context) error
+}
+
+// ProbeURL requests url with transport, or the default transport when nil.
+// Any answer below 500 means the upstream is up, even if the key is rejected.
+func ProbeURL(ctx context.Context, transport http.RoundTripper, url string, header http.Header) error {
+	client := http.Client{
+		Transport: transport,
+		Timeout:   ProbeTimeout,
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("error creating probe request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	}
+	return nil
+}
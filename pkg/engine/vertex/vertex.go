@@ -67,6 +67,19 @@ func (e *VertexEngine) ListModels() ([]openai_schema.Model, error) {
 	return []openai_schema.Model{}, nil
 }
 
+// Probe lists Google's publisher models, which needs working credentials but no project
+func (e *VertexEngine) Probe(ctx context.Context) error {
+	if len(e.backends) == 0 {
+		return fmt.Errorf("vertex engine is disabled")
+	}
+	token, err := getAccessToken()
+	if err != nil {
+		return fmt.Errorf("error obtaining access token: %w", err)
+	}
+	header := http.Header{"Authorization": {"Bearer " + token}}
+	return engine.ProbeURL(ctx, nil, e.backends[0].BackendURL.String()+"/v1beta1/publishers/google/models", header)
+}
+
 func (e *VertexEngine) IsAllowedPath(path string) bool {
 	trimmedPath := strings.TrimPrefix(path, e.prefix)
 	if strings.HasPrefix(trimmedPath, "/v1/projects/") || strings.HasPrefix(trimmedPath, "/v1beta1/projects/") {
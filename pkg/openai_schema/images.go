@@ -0,0 +1,26 @@
+package openai_schema
+
+// ImageGenerationRequest is the body of /v1/images/generations
+type ImageGenerationRequest struct {
+	Model          string  `json:"model"`
+	Prompt         string  `json:"prompt"`
+	N              *int    `json:"n,omitempty"`
+	Size           string  `json:"size,omitempty"`
+	Quality        string  `json:"quality,omitempty"`
+	Style          string  `json:"style,omitempty"`
+	ResponseFormat string  `json:"response_format,omitempty"`
+	User           *string `json:"user,omitempty"`
+}
+
+// ImageGenerationResponse is the response of /v1/images/generations
+type ImageGenerationResponse struct {
+	Created int64       `json:"created"`
+	Data    []ImageData `json:"data"`
+}
+
+// ImageData is a generated image, either base64 encoded or as a URL
+type ImageData struct {
+	B64JSON       string `json:"b64_json,omitempty"`
+	URL           string `json:"url,omitempty"`
+	RevisedPrompt string `json:"revised_prompt,omitempty"`
+}
@@ -0,0 +1,21 @@
+package openai_schema
+
+// RerankRequest is the body of /v1/rerank. OpenAI has no rerank API, the
+// shape follows Cohere's.
+type RerankRequest struct {
+	Model     string   `json:"model"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      *int     `json:"top_n,omitempty"`
+}
+
+// RerankResponse lists the documents by relevance, highest first
+type RerankResponse struct {
+	Results []RerankResult `json:"results"`
+}
+
+// RerankResult is a document's index in the request and its relevance to the query
+type RerankResult struct {
+	Index          int     `json:"index"`
+	RelevanceScore float64 `json:"relevance_score"`
+}
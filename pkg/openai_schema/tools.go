@@ -0,0 +1,174 @@
+package openai_schema
+
+import (
+	"fmt"
+	"slices"
+)
+
+// jsonSchemaTypes are the type names JSON Schema defines
+var jsonSchemaTypes = []string{"object", "array", "string", "number", "integer", "boolean", "null"}
+
+// ValidateTools checks that every function tool's parameters are a structurally
+// valid JSON Schema object and that tool_choice is one every engine understands,
+// so mistakes are rejected before the request is sent upstream
+func (r *IncomingChatCompletionRequest) ValidateTools() error {
+	if err := r.validateToolChoice(); err != nil {
+		return err
+	}
+	for i, tool := range r.Tools {
+		if tool.Function.Parameters == nil {
+			continue
+		}
+		if err := validateSchema("parameters", tool.Function.Parameters); err != nil {
+			return fmt.Errorf("tool at index %d (%s) has invalid parameters: %w", i, tool.Function.Name, err)
+		}
+		if t, ok := tool.Function.Parameters["type"]; ok && t != "object" {
+			return fmt.Errorf("tool at index %d (%s) has invalid parameters: parameters.type must be \"object\"", i, tool.Function.Name)
+		}
+	}
+	return nil
+}
+
+// validateToolChoice accepts "auto", "none", "required" and
+// {"type": "function", "function": {"name": ...}} naming one of the tools
+func (r *IncomingChatCompletionRequest) validateToolChoice() error {
+	switch choice := r.ToolChoice.(type) {
+	case nil:
+		return nil
+	case string:
+		switch choice {
+		case "auto", "none":
+			return nil
+		case "required":
+			if len(r.Tools) == 0 {
+				return fmt.Errorf("'tool_choice' is \"required\" but no 'tools' were provided")
+			}
+			return nil
+		}
+		return fmt.Errorf("'tool_choice' must be \"auto\", \"none\", \"required\" or a function object, got %q", choice)
+	case map[string]interface{}:
+		function, _ := choice["function"].(map[string]interface{})
+		name, _ := function["name"].(string)
+		if choice["type"] != "function" || name == "" {
+			return fmt.Errorf("'tool_choice' object must be {\"type\": \"function\", \"function\": {\"name\": ...}}")
+		}
+		if !slices.ContainsFunc(r.Tools, func(t FunctionTool) bool { return t.Function.Name == name }) {
+			return fmt.Errorf("'tool_choice' names function %q, which is not in 'tools'", name)
+		}
+		return nil
+	}
+	return fmt.Errorf("'tool_choice' must be a string or an object")
+}
+
+// validateSchema checks the keywords of schema that describe its structure. path
+// names the schema in errors, e.g. "parameters.properties.city". Only shapes
+// JSON Schema doesn't allow are rejected, unknown keywords are left alone.
+func validateSchema(path string, schema map[string]interface{}) error {
+	if t, ok := schema["type"]; ok {
+		if err := validateType(path, t); err != nil {
+			return err
+		}
+	}
+
+	if value, ok := schema["properties"]; ok {
+		properties, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s.properties must be an object", path)
+		}
+		for name, property := range properties {
+			if err := validateSubschema(path+".properties."+name, property); err != nil {
+				return err
+			}
+		}
+	}
+
+	if value, ok := schema["additionalProperties"]; ok {
+		if err := validateSubschema(path+".additionalProperties", value); err != nil {
+			return err
+		}
+	}
+
+	// Listing a property that isn't in properties is valid, it only has to be present
+	if value, ok := schema["required"]; ok {
+		required, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s.required must be an array of property names", path)
+		}
+		for _, item := range required {
+			if _, ok := item.(string); !ok {
+				return fmt.Errorf("%s.required must be an array of property names", path)
+			}
+		}
+	}
+
+	// items is a schema, or an array of schemas in the tuple form of older drafts
+	if value, ok := schema["items"]; ok {
+		if tuple, ok := value.([]interface{}); ok {
+			if err := validateSchemaArray(path+".items", tuple); err != nil {
+				return err
+			}
+		} else if err := validateSubschema(path+".items", value); err != nil {
+			return err
+		}
+	}
+
+	for _, keyword := range []string{"prefixItems", "anyOf", "oneOf", "allOf"} {
+		value, ok := schema[keyword]
+		if !ok {
+			continue
+		}
+		schemas, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s.%s must be an array of schemas", path, keyword)
+		}
+		if err := validateSchemaArray(path+"."+keyword, schemas); err != nil {
+			return err
+		}
+	}
+
+	if value, ok := schema["enum"]; ok {
+		if _, ok := value.([]interface{}); !ok {
+			return fmt.Errorf("%s.enum must be an array", path)
+		}
+	}
+	return nil
+}
+
+// validateSubschema accepts a schema object or a boolean schema
+func validateSubschema(path string, value interface{}) error {
+	switch schema := value.(type) {
+	case bool:
+		return nil
+	case map[string]interface{}:
+		return validateSchema(path, schema)
+	}
+	return fmt.Errorf("%s must be a schema object or boolean", path)
+}
+
+func validateSchemaArray(path string, schemas []interface{}) error {
+	for i, schema := range schemas {
+		if err := validateSubschema(fmt.Sprintf("%s[%d]", path, i), schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateType accepts a JSON Schema type name or an array of them
+func validateType(path string, value interface{}) error {
+	switch t := value.(type) {
+	case string:
+		if slices.Contains(jsonSchemaTypes, t) {
+			return nil
+		}
+	case []interface{}:
+		for _, item := range t {
+			name, ok := item.(string)
+			if !ok || !slices.Contains(jsonSchemaTypes, name) {
+				return fmt.Errorf("%s.type has an unknown type %v", path, item)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%s.type has an unknown type %v", path, value)
+}
@@ -0,0 +1,63 @@
+package openai_schema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateToolsSchemas(t *testing.T) {
+	tests := []struct {
+		name       string
+		parameters string
+		wantErr    string
+	}{
+		{name: "no parameters", parameters: `null`},
+		{name: "simple object", parameters: `{"type":"object","properties":{"city":{"type":"string"}},"required":["city"]}`},
+		{name: "type array", parameters: `{"type":"object","properties":{"n":{"type":["integer","null"]}}}`},
+		{name: "items schema", parameters: `{"type":"object","properties":{"tags":{"type":"array","items":{"type":"string"}}}}`},
+		{name: "items tuple", parameters: `{"type":"object","properties":{"point":{"type":"array","items":[{"type":"number"},{"type":"number"}]}}}`},
+		{name: "items boolean", parameters: `{"type":"object","properties":{"anything":{"type":"array","items":true}}}`},
+		{name: "prefixItems", parameters: `{"type":"object","properties":{"pair":{"type":"array","prefixItems":[{"type":"string"},true],"items":false}}}`},
+		{name: "boolean property", parameters: `{"type":"object","properties":{"extra":true,"never":false}}`},
+		{name: "required not in properties", parameters: `{"type":"object","properties":{"a":{"type":"string"}},"required":["a","b"]}`},
+		{name: "required without properties", parameters: `{"type":"object","required":["a"]}`},
+		{name: "additionalProperties boolean", parameters: `{"type":"object","additionalProperties":false}`},
+		{name: "additionalProperties schema", parameters: `{"type":"object","additionalProperties":{"type":"number"}}`},
+		{name: "anyOf", parameters: `{"type":"object","properties":{"id":{"anyOf":[{"type":"string"},{"type":"integer"}]}}}`},
+		{name: "empty enum", parameters: `{"type":"object","properties":{"x":{"enum":[]}}}`},
+		{name: "unknown keywords", parameters: `{"type":"object","$defs":{"a":{"type":"string"}},"x-custom":1}`},
+
+		{name: "not an object type", parameters: `{"type":"array"}`, wantErr: `parameters.type must be "object"`},
+		{name: "unknown type", parameters: `{"type":"object","properties":{"a":{"type":"text"}}}`, wantErr: "parameters.properties.a.type has an unknown type text"},
+		{name: "properties not an object", parameters: `{"type":"object","properties":["a"]}`, wantErr: "parameters.properties must be an object"},
+		{name: "property is a string", parameters: `{"type":"object","properties":{"a":"string"}}`, wantErr: "parameters.properties.a must be a schema object or boolean"},
+		{name: "required not an array", parameters: `{"type":"object","required":"a"}`, wantErr: "parameters.required must be an array of property names"},
+		{name: "required with a number", parameters: `{"type":"object","required":[1]}`, wantErr: "parameters.required must be an array of property names"},
+		{name: "items is a string", parameters: `{"type":"object","properties":{"a":{"type":"array","items":"string"}}}`, wantErr: "parameters.properties.a.items must be a schema object or boolean"},
+		{name: "tuple item is a string", parameters: `{"type":"object","properties":{"a":{"type":"array","items":[{"type":"string"},"number"]}}}`, wantErr: "parameters.properties.a.items[1] must be a schema object or boolean"},
+		{name: "anyOf not an array", parameters: `{"type":"object","anyOf":{"type":"string"}}`, wantErr: "parameters.anyOf must be an array of schemas"},
+		{name: "enum not an array", parameters: `{"type":"object","properties":{"x":{"enum":"a"}}}`, wantErr: "parameters.properties.x.enum must be an array"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var parameters map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.parameters), &parameters); err != nil {
+				t.Fatal(err)
+			}
+			req := IncomingChatCompletionRequest{
+				Tools: []FunctionTool{{Type: "function", Function: FunctionDetails{Name: "f", Parameters: parameters}}},
+			}
+			err := req.ValidateTools()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateTools() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateTools() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
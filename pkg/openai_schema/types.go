@@ -13,30 +13,74 @@ type Model struct {
 	Object  string `json:"object"`
 	Created int64  `json:"created"`
 	OwnedBy string `json:"owned_by"`
+	// InputModalities and OutputModalities are lower case, e.g. "text", "image", "embedding"
+	InputModalities  []string `json:"input_modalities,omitempty"`
+	OutputModalities []string `json:"output_modalities,omitempty"`
+	// ContextLength and MaxOutputTokens are in tokens, omitted when the engine doesn't know them
+	ContextLength   *int `json:"context_length,omitempty"`
+	MaxOutputTokens *int `json:"max_output_tokens,omitempty"`
+	// Capabilities lists supported features, e.g. "streaming", "tools", "vision"
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// StreamingSupported is set by engines that know whether the model can
+	// stream, nil when unknown
+	StreamingSupported *bool `json:"-"`
 }
 
 type IncomingChatCompletionRequest struct {
-	Model            string         `json:"model"`                       // The model to use (e.g., "gpt-4").
-	Messages         []ChatMessage  `json:"messages"`                    // An array of messages in the conversation.
-	Temperature      *float64       `json:"temperature,omitempty"`       // Sampling temperature (0-2).
-	TopP             *float64       `json:"top_p,omitempty"`             // Top-p sampling (0-1).
-	N                *int           `json:"n,omitempty"`                 // Number of completions to generate.
-	Stream           bool           `json:"stream"`                      // Whether to stream results.
-	Stop             *string        `json:"stop,omitempty"`              // Stop sequence for response generation.
-	MaxTokens        *int           `json:"max_tokens,omitempty"`        // Maximum number of tokens to generate.
-	PresencePenalty  *float64       `json:"presence_penalty,omitempty"`  // Penalty for new topics.
-	FrequencyPenalty *float64       `json:"frequency_penalty,omitempty"` // Penalty for repeated phrases.
-	User             *string        `json:"user,omitempty"`              // User identifier for personalization.
-	Tools            []FunctionTool `json:"tools,omitempty"`             // Tools available for the model.
-	ToolChoice       interface{}    `json:"tool_choice,omitempty"`       // Controls which (if any) tool is called by the model.
+	Model               string            `json:"model"`                           // The model to use (e.g., "gpt-4").
+	Messages            []ChatMessage     `json:"messages"`                        // An array of messages in the conversation.
+	Temperature         *float64          `json:"temperature,omitempty"`           // Sampling temperature (0-2).
+	TopP                *float64          `json:"top_p,omitempty"`                 // Top-p sampling (0-1).
+	TopK                *int              `json:"top_k,omitempty"`                 // Top-k sampling (Anthropic/Gemini models only).
+	N                   *int              `json:"n,omitempty"`                     // Number of completions to generate.
+	Stream              bool              `json:"stream"`                          // Whether to stream results.
+	StreamOptions       *StreamOptions    `json:"stream_options,omitempty"`        // Options for streaming responses.
+	Stop                StopSequences     `json:"stop,omitempty"`                  // Stop sequences for response generation.
+	MaxTokens           *int              `json:"max_tokens,omitempty"`            // Maximum number of tokens to generate.
+	MaxCompletionTokens *int              `json:"max_completion_tokens,omitempty"` // Maximum number of tokens to generate, replaces max_tokens.
+	PresencePenalty     *float64          `json:"presence_penalty,omitempty"`      // Penalty for new topics.
+	FrequencyPenalty    *float64          `json:"frequency_penalty,omitempty"`     // Penalty for repeated phrases.
+	LogitBias           map[string]int    `json:"logit_bias,omitempty"`            // Token ID to bias (-100 to 100) added to its logit.
+	Logprobs            *bool             `json:"logprobs,omitempty"`              // Whether to return log probabilities of the output tokens.
+	TopLogprobs         *int              `json:"top_logprobs,omitempty"`          // Number of most likely tokens to return at each position (0-20).
+	User                *string           `json:"user,omitempty"`                  // User identifier for personalization.
+	Metadata            map[string]string `json:"metadata,omitempty"`              // Developer-defined tags attached to the request.
+	Tools               []FunctionTool    `json:"tools,omitempty"`                 // Tools available for the model.
+	ToolChoice          interface{}       `json:"tool_choice,omitempty"`           // Controls which (if any) tool is called by the model.
+	ParallelToolCalls   *bool             `json:"parallel_tool_calls,omitempty"`   // Whether the model may call several tools in one turn.
+}
+
+// StreamOptions holds the OpenAI `stream_options` object
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"` // Send a final chunk with token usage.
+	// Unrecognized lists keys the proxy doesn't know how to honor so transformers can report them.
+	Unrecognized []string `json:"-"`
 }
 
+// StopSequences holds the OpenAI `stop` parameter, which may be sent either
+// as a single string or as an array of strings.
+type StopSequences []string
+
 type ChatMessage struct {
 	Role     string        `json:"role"`                // The role of the message sender ("system", "user", "assistant").
 	Type     *string       `json:"type,omitempty"`      // Type of the message (e.g., "image_url").
 	Content  *string       `json:"content,omitempty"`   // The text content of the message (optional if image is present).
 	ImageURL *ChatImageURL `json:"image_url,omitempty"` // An image associated with the message (optional if content is present).
 	Name     *string       `json:"name,omitempty"`      // Optional name of the user.
+	// ToolCalls are the tool calls made by an assistant message.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID is the tool call a "tool" message answers.
+	ToolCallID *string `json:"tool_call_id,omitempty"`
+	// ContentParts holds the content when it was sent in the array form, Content is nil then.
+	ContentParts []ContentPart `json:"-"`
+}
+
+// ContentPart is one element of the array form of a message's content
+type ContentPart struct {
+	Type     string        `json:"type"`                // "text" or "image_url".
+	Text     string        `json:"text,omitempty"`      // The text of a text part.
+	ImageURL *ChatImageURL `json:"image_url,omitempty"` // The image of an image_url part.
 }
 
 type ChatImageURL struct {
@@ -45,6 +89,18 @@ type ChatImageURL struct {
 	AltText *string `json:"alt_text,omitempty"` // Optional alt text describing the image.
 }
 
+// ToolCall is a function call requested by the model
+type ToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function ToolCallFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"` // JSON encoded arguments.
+}
+
 type FunctionTool struct {
 	Type     string          `json:"type"`     // Type of the tool, e.g., "function".
 	Function FunctionDetails `json:"function"` // Details of the function tool.
@@ -54,35 +110,120 @@ type FunctionDetails struct {
 	Name        string                 `json:"name"`        // Name of the function.
 	Description string                 `json:"description"` // Description of the function.
 	Parameters  map[string]interface{} `json:"parameters"`  // Parameters schema for the function.
+	// Strict asks the model to follow the parameters schema exactly (OpenAI structured outputs).
+	Strict *bool `json:"strict,omitempty"`
 }
 
-type ToolConfig struct {
-	Tools      []Tool     `json:"tools"`
-	ToolChoice ToolChoice `json:"toolChoice,omitempty"`
+// UnmarshalJSON decodes the known stream options and records any other keys
+func (o *StreamOptions) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return errors.New("'stream_options' must be an object")
+	}
+	for key, value := range raw {
+		switch key {
+		case "include_usage":
+			if err := json.Unmarshal(value, &o.IncludeUsage); err != nil {
+				return errors.New("'stream_options.include_usage' must be a boolean")
+			}
+		default:
+			o.Unrecognized = append(o.Unrecognized, key)
+		}
+	}
+	return nil
 }
 
-type Tool struct {
-	ToolSpec ToolSpec `json:"tool_spec"`
-}
+// UnmarshalJSON accepts `stop` as either a string or an array of strings
+// and normalizes both forms to a slice.
+func (s *StopSequences) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*s = nil
+		return nil
+	}
 
-type ToolSpec struct {
-	Name        string      `json:"name"`
-	Description string      `json:"description"`
-	InputSchema InputSchema `json:"input_schema"`
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = StopSequences{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return errors.New("'stop' must be a string or an array of strings")
+	}
+	*s = multiple
+	return nil
 }
 
-type InputSchema struct {
-	JSON interface{} `json:"json"`
+// UnmarshalJSON accepts `content` as either a string or an array of content parts
+func (m *ChatMessage) UnmarshalJSON(data []byte) error {
+	type Alias ChatMessage
+	aux := &struct {
+		Content json.RawMessage `json:"content"`
+		*Alias
+	}{
+		Alias: (*Alias)(m),
+	}
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+
+	m.Content = nil
+	m.ContentParts = nil
+	if len(aux.Content) == 0 || string(aux.Content) == "null" {
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(aux.Content, &text); err == nil {
+		m.Content = &text
+		return nil
+	}
+
+	var parts []ContentPart
+	if err := json.Unmarshal(aux.Content, &parts); err != nil {
+		return errors.New("'content' must be a string or an array of content parts")
+	}
+	for i, part := range parts {
+		switch part.Type {
+		case "text":
+		case "image_url":
+			if part.ImageURL == nil || part.ImageURL.URL == "" {
+				return fmt.Errorf("content part at index %d of type 'image_url' must have an 'image_url.url'", i)
+			}
+		default:
+			return fmt.Errorf("content part at index %d has an unsupported 'type': %s", i, part.Type)
+		}
+	}
+	m.ContentParts = parts
+	return nil
 }
 
-type ToolChoice struct {
-	Auto *struct{} `json:"auto,omitempty"`
-	Any  *struct{} `json:"any,omitempty"`
-	Tool *ToolName `json:"tool,omitempty"`
+// MarshalJSON writes ContentParts back in the array form of `content`
+func (m ChatMessage) MarshalJSON() ([]byte, error) {
+	type Alias ChatMessage
+	if m.ContentParts == nil {
+		return json.Marshal(Alias(m))
+	}
+	return json.Marshal(struct {
+		Alias
+		Content []ContentPart `json:"content"`
+	}{
+		Alias:   Alias(m),
+		Content: m.ContentParts,
+	})
 }
 
-type ToolName struct {
-	Name string `json:"name"`
+// CollapseSingleTextContent rewrites messages whose content is an array with a
+// single text part to the plain string form, which every provider handles the same way
+func (r *IncomingChatCompletionRequest) CollapseSingleTextContent() {
+	for i, msg := range r.Messages {
+		if len(msg.ContentParts) == 1 && msg.ContentParts[0].Type == "text" {
+			text := msg.ContentParts[0].Text
+			r.Messages[i].Content = &text
+			r.Messages[i].ContentParts = nil
+		}
+	}
 }
 
 // UnmarshalJSON Custom UnmarshalJSON for IncomingChatCompletionRequest
@@ -120,6 +261,7 @@ func (r *IncomingChatCompletionRequest) UnmarshalJSON(data []byte) error {
 			"system":    true,
 			"user":      true,
 			"assistant": true,
+			"tool":      true,
 			// Add other valid roles if any
 		}
 		if !validRoles[msg.Role] {
@@ -140,13 +282,36 @@ func (r *IncomingChatCompletionRequest) UnmarshalJSON(data []byte) error {
 			if _, err := url.ParseRequestURI(msg.ImageURL.URL); err != nil {
 				return fmt.Errorf("message at index %d has an invalid URL in 'image_url': %v", i, err)
 			}
+		} else if msg.Role == "tool" {
+			if msg.ToolCallID == nil || *msg.ToolCallID == "" {
+				return fmt.Errorf("message at index %d with role 'tool' must have a 'tool_call_id'", i)
+			}
 		} else {
-			// For non-image messages, Content must not be nil or empty
-			if msg.Content == nil || *msg.Content == "" {
+			// For non-image messages, Content must not be nil or empty unless the assistant calls tools
+			if (msg.Content == nil || *msg.Content == "") && len(msg.ContentParts) == 0 && len(msg.ToolCalls) == 0 {
 				return fmt.Errorf("message at index %d must have 'content' field when 'type' is not 'image_url'", i)
 			}
 		}
 	}
 
+	r.normalizeN()
+
 	return nil
 }
+
+// normalizeN defaults the candidate count to 1 when `n` is omitted or not positive
+func (r *IncomingChatCompletionRequest) normalizeN() {
+	if r.N == nil || *r.N < 1 {
+		n := 1
+		r.N = &n
+	}
+}
+
+// OutputTokenLimit returns the requested output token limit. max_completion_tokens
+// takes precedence over the older max_tokens when both are set.
+func (r *IncomingChatCompletionRequest) OutputTokenLimit() *int {
+	if r.MaxCompletionTokens != nil {
+		return r.MaxCompletionTokens
+	}
+	return r.MaxTokens
+}
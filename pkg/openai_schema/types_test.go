@@ -0,0 +1,126 @@
+package openai_schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestLogprobsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want map[string]interface{}
+	}{
+		{
+			name: "all set",
+			body: `{"model":"openai/gpt-4o","messages":[{"role":"user","content":"hi"}],"logit_bias":{"50256":-100,"1234":5},"logprobs":true,"top_logprobs":5}`,
+			want: map[string]interface{}{
+				"logit_bias":   map[string]interface{}{"50256": float64(-100), "1234": float64(5)},
+				"logprobs":     true,
+				"top_logprobs": float64(5),
+			},
+		},
+		{
+			name: "explicit zero values are kept",
+			body: `{"model":"openai/gpt-4o","messages":[{"role":"user","content":"hi"}],"logprobs":false,"top_logprobs":0}`,
+			want: map[string]interface{}{
+				"logprobs":     false,
+				"top_logprobs": float64(0),
+			},
+		},
+		{
+			name: "omitted",
+			body: `{"model":"openai/gpt-4o","messages":[{"role":"user","content":"hi"}]}`,
+			want: map[string]interface{}{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req IncomingChatCompletionRequest
+			if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+				t.Fatalf("Unmarshal error = %v", err)
+			}
+			out, err := json.Marshal(req)
+			if err != nil {
+				t.Fatalf("Marshal error = %v", err)
+			}
+			var fields map[string]interface{}
+			if err := json.Unmarshal(out, &fields); err != nil {
+				t.Fatalf("Unmarshal of %s error = %v", out, err)
+			}
+			for _, key := range []string{"logit_bias", "logprobs", "top_logprobs"} {
+				want, wantOK := tt.want[key]
+				got, gotOK := fields[key]
+				if gotOK != wantOK || !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %v (present %t), want %v (present %t) in %s", key, got, gotOK, want, wantOK, out)
+				}
+			}
+		})
+	}
+}
+
+func TestOutputTokenLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields string
+		want   *int
+	}{
+		{"neither", `"stream":false`, nil},
+		{"max_tokens", `"max_tokens":100`, intPtr(100)},
+		{"max_completion_tokens", `"max_completion_tokens":200`, intPtr(200)},
+		{"max_completion_tokens wins", `"max_tokens":100,"max_completion_tokens":200`, intPtr(200)},
+		{"max_completion_tokens wins when lower", `"max_tokens":300,"max_completion_tokens":200`, intPtr(200)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req IncomingChatCompletionRequest
+			body := `{"model":"openai/gpt-4o","messages":[{"role":"user","content":"hi"}],` + tt.fields + `}`
+			if err := json.Unmarshal([]byte(body), &req); err != nil {
+				t.Fatal(err)
+			}
+			got := req.OutputTokenLimit()
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("OutputTokenLimit() = %v, want %v", deref(got), deref(tt.want))
+			}
+		})
+	}
+}
+
+func intPtr(i int) *int { return &i }
+
+// deref prints nil limits as <nil> instead of an address
+func deref(i *int) interface{} {
+	if i == nil {
+		return nil
+	}
+	return *i
+}
+
+func TestNormalizeN(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields string
+		want   int
+	}{
+		{"omitted", `"stream":false`, 1},
+		{"null", `"n":null`, 1},
+		{"zero", `"n":0`, 1},
+		{"negative", `"n":-2`, 1},
+		{"one", `"n":1`, 1},
+		{"kept above one", `"n":3`, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req IncomingChatCompletionRequest
+			body := `{"model":"openai/gpt-4o","messages":[{"role":"user","content":"hi"}],` + tt.fields + `}`
+			if err := json.Unmarshal([]byte(body), &req); err != nil {
+				t.Fatal(err)
+			}
+			if req.N == nil || *req.N != tt.want {
+				t.Errorf("N = %v, want %d", deref(req.N), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/robertprast/goop/pkg/utils"
+)
+
+// handleAudioTranscriptions handles the /openai-proxy/v1/audio/transcriptions
+// endpoint. The multipart body is streamed through to the openai engine, the
+// transcription is returned unchanged.
+func (h *OpenAIProxyHandler) handleAudioTranscriptions(w http.ResponseWriter, r *http.Request) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			h.logger.Errorf("Error closing body: %v", err)
+		}
+	}(r.Body)
+	if entry := accessLogFromContext(r.Context()); entry != nil {
+		entry.Engine = "openai"
+	}
+
+	proxy, err := h.openAIPassthrough("openai", "")
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "engine_selection_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusNotFound, utils.ErrTypeInvalidRequest, "model_not_found", "OpenAI engine is not configured")
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	body, err := proxy.TransformTranscriptionRequest(r.Context(), contentType, r.Body)
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "transform_request_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "", fmt.Sprintf("Error transforming request: %v", err))
+		return
+	}
+	// Runs before r.Body is closed, closing waits until the rewrite stopped reading r.Body
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(body)
+
+	resp, err := proxy.HandleTranscriptionRequest(r.Context(), contentType, body)
+	if isBodyTooLarge(err) {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "body_too_large").Inc()
+		utils.WriteOpenAIError(w, http.StatusRequestEntityTooLarge, utils.ErrTypeInvalidRequest, "request_too_large", "Request body too large")
+		return
+	}
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "handle_request_error").Inc()
+		h.logger.Infof("Error sending transcription request: %v", err)
+		utils.WriteOpenAIError(w, http.StatusBadGateway, utils.ErrTypeAPI, "upstream_error", fmt.Sprintf("Error processing request: %v", err))
+		return
+	}
+
+	if err := proxy.SendChatCompletionResponse(r.Context(), resp, w, false); err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "send_response_error").Inc()
+		h.logger.Errorf("Error sending transcription response: %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/robertprast/goop/pkg/utils"
+)
+
+const (
+	defaultBreakerErrorRatio  = 0.5
+	defaultBreakerMinRequests = 10
+	defaultBreakerWindow      = time.Minute
+	defaultBreakerCooldown    = 30 * time.Second
+)
+
+type breakerState string
+
+const (
+	breakerClosed   breakerState = "closed"
+	breakerOpen     breakerState = "open"
+	breakerHalfOpen breakerState = "half_open"
+)
+
+// breaker tracks one engine's failures in fixed windows
+type breaker struct {
+	state       breakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	// probing is set while the single half-open probe request is in flight
+	probing bool
+}
+
+// circuitBreakers keeps a circuit breaker per engine. A breaker opens when the
+// failure ratio within the window crosses the threshold, rejects requests for
+// the cooldown, then lets one probe through: success closes it, failure reopens it.
+type circuitBreakers struct {
+	mu          sync.Mutex
+	errorRatio  float64
+	minRequests int
+	window      time.Duration
+	cooldown    time.Duration
+	breakers    map[string]*breaker
+	// onTransition is called with the engine and its new state, under the lock
+	onTransition func(engine string, state breakerState)
+}
+
+func newCircuitBreakers(config utils.CircuitBreakerConfig, onTransition func(string, breakerState)) *circuitBreakers {
+	b := &circuitBreakers{
+		errorRatio:   config.ErrorRatio,
+		minRequests:  config.MinRequests,
+		window:       config.Window,
+		cooldown:     config.Cooldown,
+		breakers:     make(map[string]*breaker),
+		onTransition: onTransition,
+	}
+	if b.errorRatio <= 0 {
+		b.errorRatio = defaultBreakerErrorRatio
+	}
+	if b.minRequests <= 0 {
+		b.minRequests = defaultBreakerMinRequests
+	}
+	if b.window <= 0 {
+		b.window = defaultBreakerWindow
+	}
+	if b.cooldown <= 0 {
+		b.cooldown = defaultBreakerCooldown
+	}
+	return b
+}
+
+// Allow reports whether a request may be sent to engine. When it may not, the
+// time until the breaker lets a probe through is returned. Every allowed
+// request must be followed by Record.
+func (b *circuitBreakers) Allow(engine string) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br := b.get(engine)
+	switch br.state {
+	case breakerOpen:
+		if wait := b.cooldown - time.Since(br.openedAt); wait > 0 {
+			return false, wait
+		}
+		b.transition(engine, br, breakerHalfOpen)
+		br.probing = true
+		return true, 0
+	case breakerHalfOpen:
+		if br.probing {
+			return false, b.cooldown
+		}
+		br.probing = true
+		return true, 0
+	default:
+		return true, 0
+	}
+}
+
+// Record counts the outcome of a request allowed by Allow
+func (b *circuitBreakers) Record(engine string, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br := b.get(engine)
+	if br.state == breakerHalfOpen {
+		br.probing = false
+		if success {
+			br.requests, br.failures = 0, 0
+			br.windowStart = time.Now()
+			b.transition(engine, br, breakerClosed)
+		} else {
+			br.openedAt = time.Now()
+			b.transition(engine, br, breakerOpen)
+		}
+		return
+	}
+	if br.state != breakerClosed {
+		return
+	}
+
+	now := time.Now()
+	if now.Sub(br.windowStart) >= b.window {
+		br.windowStart = now
+		br.requests, br.failures = 0, 0
+	}
+	br.requests++
+	if !success {
+		br.failures++
+	}
+	if br.requests >= b.minRequests && float64(br.failures)/float64(br.requests) >= b.errorRatio {
+		br.openedAt = now
+		b.transition(engine, br, breakerOpen)
+	}
+}
+
+// Release returns a request allowed by Allow without counting its outcome, for
+// requests that ended on the caller's side. A half-open breaker lets the next
+// request probe instead.
+func (b *circuitBreakers) Release(engine string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if br := b.get(engine); br.state == breakerHalfOpen {
+		br.probing = false
+	}
+}
+
+// AllOpen reports whether every named engine's breaker is rejecting requests.
+// Engines without a breaker yet count as closed.
+func (b *circuitBreakers) AllOpen(engines []string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(engines) == 0 {
+		return false
+	}
+	for _, engine := range engines {
+		br, ok := b.breakers[engine]
+		if !ok {
+			return false
+		}
+		switch br.state {
+		case breakerOpen:
+			if time.Since(br.openedAt) >= b.cooldown {
+				return false
+			}
+		case breakerHalfOpen:
+			if !br.probing {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (b *circuitBreakers) get(engine string) *breaker {
+	br, ok := b.breakers[engine]
+	if !ok {
+		br = &breaker{state: breakerClosed, windowStart: time.Now()}
+		b.breakers[engine] = br
+	}
+	return br
+}
+
+func (b *circuitBreakers) transition(engine string, br *breaker, state breakerState) {
+	br.state = state
+	if b.onTransition != nil {
+		b.onTransition(engine, state)
+	}
+}
@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robertprast/goop/pkg/utils"
+)
+
+func newTestBreakers(transitions *[]breakerState) *circuitBreakers {
+	return newCircuitBreakers(utils.CircuitBreakerConfig{
+		ErrorRatio:  0.5,
+		MinRequests: 4,
+		Window:      time.Minute,
+		Cooldown:    20 * time.Millisecond,
+	}, func(engine string, state breakerState) {
+		*transitions = append(*transitions, state)
+	})
+}
+
+func recordN(b *circuitBreakers, engine string, n int, success bool) {
+	for i := 0; i < n; i++ {
+		b.Allow(engine)
+		b.Record(engine, success)
+	}
+}
+
+func TestCircuitBreakerStaysClosedBelowThreshold(t *testing.T) {
+	var transitions []breakerState
+	b := newTestBreakers(&transitions)
+
+	// 3 failures are under MinRequests
+	recordN(b, "openai", 3, false)
+	if allowed, _ := b.Allow("openai"); !allowed {
+		t.Fatal("breaker opened before MinRequests")
+	}
+	b.Record("openai", true)
+	// The 4th request reaches MinRequests with a 0.75 failure ratio
+	if len(transitions) != 1 || transitions[0] != breakerOpen {
+		t.Fatalf("transitions = %v, want [open]", transitions)
+	}
+
+	transitions = nil
+	recordN(b, "bedrock", 8, true)
+	recordN(b, "bedrock", 3, false)
+	if allowed, _ := b.Allow("bedrock"); !allowed {
+		t.Fatal("breaker opened below the error ratio")
+	}
+	if len(transitions) != 0 {
+		t.Fatalf("transitions = %v, want none", transitions)
+	}
+}
+
+func TestCircuitBreakerOpenRejectsUntilCooldown(t *testing.T) {
+	var transitions []breakerState
+	b := newTestBreakers(&transitions)
+
+	recordN(b, "openai", 4, false)
+	allowed, retryAfter := b.Allow("openai")
+	if allowed {
+		t.Fatal("open breaker allowed a request")
+	}
+	if retryAfter <= 0 || retryAfter > 20*time.Millisecond {
+		t.Errorf("retryAfter = %s, want within the cooldown", retryAfter)
+	}
+	if allowed, _ := b.Allow("bedrock"); !allowed {
+		t.Error("breakers are not independent per engine")
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbe(t *testing.T) {
+	tests := []struct {
+		name         string
+		probeSuccess bool
+		want         []breakerState
+		wantAllowed  bool
+	}{
+		{name: "successful probe closes", probeSuccess: true, want: []breakerState{breakerOpen, breakerHalfOpen, breakerClosed}, wantAllowed: true},
+		{name: "failed probe reopens", probeSuccess: false, want: []breakerState{breakerOpen, breakerHalfOpen, breakerOpen}, wantAllowed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var transitions []breakerState
+			b := newTestBreakers(&transitions)
+			recordN(b, "openai", 4, false)
+			time.Sleep(25 * time.Millisecond)
+
+			if allowed, _ := b.Allow("openai"); !allowed {
+				t.Fatal("probe was not let through after the cooldown")
+			}
+			if allowed, _ := b.Allow("openai"); allowed {
+				t.Fatal("a second request was let through while the probe is in flight")
+			}
+			b.Record("openai", tt.probeSuccess)
+
+			if len(transitions) != len(tt.want) {
+				t.Fatalf("transitions = %v, want %v", transitions, tt.want)
+			}
+			for i := range tt.want {
+				if transitions[i] != tt.want[i] {
+					t.Fatalf("transitions = %v, want %v", transitions, tt.want)
+				}
+			}
+			if allowed, _ := b.Allow("openai"); allowed != tt.wantAllowed {
+				t.Errorf("Allow() after probe = %v, want %v", allowed, tt.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerReleaseDoesNotCount(t *testing.T) {
+	var transitions []breakerState
+	b := newTestBreakers(&transitions)
+
+	for i := 0; i < 10; i++ {
+		b.Allow("openai")
+		b.Release("openai")
+	}
+	if len(transitions) != 0 {
+		t.Fatalf("released requests changed the breaker: %v", transitions)
+	}
+
+	recordN(b, "openai", 4, false)
+	time.Sleep(25 * time.Millisecond)
+	if allowed, _ := b.Allow("openai"); !allowed {
+		t.Fatal("probe was not let through after the cooldown")
+	}
+	// A cancelled probe frees the slot without reopening or closing the breaker
+	b.Release("openai")
+	if allowed, _ := b.Allow("openai"); !allowed {
+		t.Fatal("next request could not probe after the previous probe was released")
+	}
+	if got := transitions[len(transitions)-1]; got != breakerHalfOpen {
+		t.Errorf("state after release = %s, want %s", got, breakerHalfOpen)
+	}
+}
+
+func TestCircuitBreakerAllOpen(t *testing.T) {
+	var transitions []breakerState
+	b := newTestBreakers(&transitions)
+
+	if b.AllOpen([]string{"bedrock", "openai"}) {
+		t.Error("AllOpen = true before any request")
+	}
+	recordN(b, "bedrock", 4, false)
+	if b.AllOpen([]string{"bedrock", "openai"}) {
+		t.Error("AllOpen = true with openai closed")
+	}
+	recordN(b, "openai", 4, false)
+	if !b.AllOpen([]string{"bedrock", "openai"}) {
+		t.Error("AllOpen = false with both breakers open")
+	}
+	if b.AllOpen(nil) {
+		t.Error("AllOpen = true without engines")
+	}
+
+	// Past the cooldown a probe may go through, so the engines aren't all rejecting
+	time.Sleep(25 * time.Millisecond)
+	if b.AllOpen([]string{"bedrock", "openai"}) {
+		t.Error("AllOpen = true after the cooldown")
+	}
+	b.Allow("bedrock")
+	b.Allow("openai")
+	if !b.AllOpen([]string{"bedrock", "openai"}) {
+		t.Error("AllOpen = false while both probes are in flight")
+	}
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/robertprast/goop/pkg/audit"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultStreamCaptureBuffer is the number of chunks buffered for the capture
+// sink before new chunks are dropped
+const defaultStreamCaptureBuffer = 1024
+
+// captureRecord is one streamed chunk as written to the capture file
+type captureRecord struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	Model     string    `json:"model"`
+	Data      string    `json:"data"`
+}
+
+// streamCaptureSink appends streamed chunks to a JSON lines file. Chunks are
+// queued on a buffered channel and written by a single goroutine, so a slow
+// disk never blocks the client stream. Chunks are dropped when the buffer is full.
+type streamCaptureSink struct {
+	records chan captureRecord
+	dropped atomic.Int64
+}
+
+func newStreamCaptureSink(path string, buffer int) (*streamCaptureSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if buffer <= 0 {
+		buffer = defaultStreamCaptureBuffer
+	}
+	s := &streamCaptureSink{records: make(chan captureRecord, buffer)}
+	go s.run(json.NewEncoder(file))
+	return s, nil
+}
+
+func (s *streamCaptureSink) run(enc *json.Encoder) {
+	for record := range s.records {
+		if err := enc.Encode(record); err != nil {
+			logrus.Errorf("Error writing stream capture: %v", err)
+		}
+	}
+}
+
+// capture queues a chunk without blocking
+func (s *streamCaptureSink) capture(record captureRecord) {
+	select {
+	case s.records <- record:
+	default:
+		if s.dropped.Add(1)%100 == 1 {
+			logrus.Warnf("Stream capture buffer full, %d chunks dropped so far", s.dropped.Load())
+		}
+	}
+}
+
+// captureWriter fans out everything written to the client to the capture sink
+type captureWriter struct {
+	http.ResponseWriter
+	sink      *streamCaptureSink
+	requestID string
+	model     string
+}
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(b)
+	if n > 0 {
+		c.sink.capture(captureRecord{
+			Time:      time.Now(),
+			RequestID: c.requestID,
+			Model:     c.model,
+			Data:      string(audit.RedactBody(b[:n])),
+		})
+	}
+	return n, err
+}
+
+func (c *captureWriter) Flush() {
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/robertprast/goop/pkg/utils"
+)
+
+// engineLimiter bounds in-flight upstream requests per engine with a
+// semaphore each. Requests over the limit wait up to the queue timeout.
+type engineLimiter struct {
+	slots        map[string]chan struct{}
+	queueTimeout time.Duration
+	queueDepth   *prometheus.GaugeVec
+}
+
+func newEngineLimiter(config utils.ConcurrencyConfig, queueDepth *prometheus.GaugeVec) *engineLimiter {
+	l := &engineLimiter{
+		slots:        make(map[string]chan struct{}),
+		queueTimeout: config.QueueTimeout,
+		queueDepth:   queueDepth,
+	}
+	for engine, limit := range config.MaxConcurrent {
+		if limit > 0 {
+			l.slots[engine] = make(chan struct{}, limit)
+		}
+	}
+	return l
+}
+
+// Acquire takes a slot for engine, waiting up to the queue timeout. It returns
+// the function releasing the slot, or false when no slot freed up in time.
+func (l *engineLimiter) Acquire(ctx context.Context, engine string) (func(), bool) {
+	slots, ok := l.slots[engine]
+	if !ok {
+		return func() {}, true
+	}
+	release := func() { <-slots }
+
+	select {
+	case slots <- struct{}{}:
+		return release, true
+	default:
+	}
+	if l.queueTimeout <= 0 {
+		return nil, false
+	}
+
+	l.queueDepth.WithLabelValues(engine).Inc()
+	defer l.queueDepth.WithLabelValues(engine).Dec()
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return release, true
+	case <-timer.C:
+		return nil, false
+	case <-ctx.Done():
+		return nil, false
+	}
+}
@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/robertprast/goop/pkg/utils"
+)
+
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodOptions}
+	defaultCORSHeaders = []string{"Authorization", "Content-Type"}
+)
+
+// corsMiddleware adds CORS headers for the configured allowed origins. The request
+// Origin is echoed back only when it's in the list, or "*" is sent when the list
+// contains "*". With no allowed origins configured it passes requests through untouched.
+func corsMiddleware(cfg utils.CORSConfig) Middleware {
+	methods := cfg.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	headers := cfg.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+
+	return func(next http.Handler) http.Handler {
+		if len(cfg.AllowedOrigins) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			allowedOrigin := matchOrigin(cfg.AllowedOrigins, origin)
+			if allowedOrigin != "" {
+				w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+			}
+			if allowedOrigin != "*" {
+				w.Header().Add("Vary", "Origin")
+			}
+
+			// Answer preflight requests directly
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				if allowedOrigin == "" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// matchOrigin returns the Access-Control-Allow-Origin value for origin, or "" if it isn't allowed
+func matchOrigin(allowedOrigins []string, origin string) string {
+	if origin == "" {
+		return ""
+	}
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/robertprast/goop/pkg/audit"
+)
+
+const defaultDeadLetterPath = "dead_letter.jsonl"
+
+// deadLetterEntry is a failed upstream request with enough detail to replay it
+type deadLetterEntry struct {
+	Time      time.Time       `json:"time"`
+	RequestID string          `json:"request_id"`
+	Model     string          `json:"model"`
+	Engine    string          `json:"engine"`
+	Target    string          `json:"target,omitempty"`
+	Status    int             `json:"status,omitempty"`
+	Error     string          `json:"error"`
+	Headers   http.Header     `json:"headers"`
+	Body      json.RawMessage `json:"body"`
+}
+
+// deadLetterSink appends failed upstream requests to a JSON lines file
+type deadLetterSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newDeadLetterSink(path string) (*deadLetterSink, error) {
+	if path == "" {
+		path = defaultDeadLetterPath
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &deadLetterSink{file: file}, nil
+}
+
+// record writes entry, client headers are redacted first
+func (s *deadLetterSink) record(entry deadLetterEntry) error {
+	entry.Headers = audit.RedactHeaders(entry.Headers)
+	if !json.Valid(entry.Body) {
+		quoted, err := json.Marshal(string(entry.Body))
+		if err != nil {
+			return err
+		}
+		entry.Body = quoted
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/robertprast/goop/pkg/utils"
+)
+
+// readDeadLetters parses every entry of a dead letter file
+func readDeadLetters(t *testing.T, path string) []deadLetterEntry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []deadLetterEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry deadLetterEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid dead letter line %s: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestFailedRequestWritesDeadLetter(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"overloaded"}}`, http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	path := filepath.Join(t.TempDir(), "dead_letter.jsonl")
+	config := &utils.Config{}
+	config.DeadLetter = utils.DeadLetterConfig{Enabled: true, Path: path}
+	handler, engines := newTestHandler(t, config, map[string]string{"ollama": "base_url: " + upstream.URL})
+
+	req := httptest.NewRequest(http.MethodPost, "/openai-proxy/v1/chat/completions", strings.NewReader(chatBody("ollama/llama3")))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want the upstream's %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	engines.Reload(map[string]string{"ollama": "base_url: " + unreachable.URL})
+	if rec := postChat(t, handler, chatBody("ollama/llama3")); rec.Code != http.StatusBadGateway {
+		t.Fatalf("status for an unreachable upstream = %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+
+	entries := readDeadLetters(t, path)
+	if len(entries) != 2 {
+		t.Fatalf("got %d dead letter entries, want 2", len(entries))
+	}
+
+	failed := entries[0]
+	if requestID := rec.Header().Get("X-Request-Id"); failed.RequestID != requestID {
+		t.Errorf("request id = %q, want %q", failed.RequestID, requestID)
+	}
+	if failed.Model != "ollama/llama3" || failed.Engine != "ollama" || failed.Status != http.StatusServiceUnavailable {
+		t.Errorf("entry = %+v, want the ollama/llama3 503", failed)
+	}
+	if failed.Target != upstream.URL+"/v1/chat/completions" || !strings.Contains(failed.Error, "overloaded") {
+		t.Errorf("target, error = %q, %q, want the upstream url and its error body", failed.Target, failed.Error)
+	}
+	if auth := failed.Headers.Get("Authorization"); auth == "" || strings.Contains(auth, "sk-secret") {
+		t.Errorf("Authorization = %q, want it redacted", auth)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(failed.Body, &body); err != nil || body["model"] != "llama3" {
+		t.Errorf("body = %s, want the transformed request", failed.Body)
+	}
+
+	if unreachableEntry := entries[1]; unreachableEntry.Status != 0 || !strings.Contains(unreachableEntry.Error, "connection refused") {
+		t.Errorf("entry = %+v, want the connection error", unreachableEntry)
+	}
+}
+
+func TestSuccessfulRequestSkipsDeadLetter(t *testing.T) {
+	upstream := newOllamaServer(t, "llama3")
+	path := filepath.Join(t.TempDir(), "dead_letter.jsonl")
+	config := &utils.Config{}
+	config.DeadLetter = utils.DeadLetterConfig{Enabled: true, Path: path}
+	handler, _ := newTestHandler(t, config, map[string]string{"ollama": "base_url: " + upstream.URL})
+
+	if rec := postChat(t, handler, chatBody("ollama/llama3")); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if entries := readDeadLetters(t, path); len(entries) != 0 {
+		t.Errorf("got %d dead letter entries for a successful request, want none", len(entries))
+	}
+}
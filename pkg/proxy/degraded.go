@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const defaultDegradedMessage = "The service is temporarily unavailable. Please try again later."
+
+// writeDegradedResponse answers a chat completion with the configured static
+// assistant message, flagged with the X-Goop-Degraded header
+func (h *OpenAIProxyHandler) writeDegradedResponse(w http.ResponseWriter, model string, stream bool) error {
+	message := h.config.DegradedMode.Message
+	if message == "" {
+		message = defaultDegradedMessage
+	}
+	id := "chatcmpl-" + uuid.New().String()
+	created := time.Now().Unix()
+
+	w.Header().Set("X-Goop-Degraded", "true")
+
+	if !stream {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		return json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":      id,
+			"object":  "chat.completion",
+			"created": created,
+			"model":   model,
+			"choices": []map[string]interface{}{
+				{
+					"index":         0,
+					"message":       map[string]interface{}{"role": "assistant", "content": message},
+					"finish_reason": "stop",
+				},
+			},
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	chunk, err := json.Marshal(map[string]interface{}{
+		"id":      id,
+		"object":  "chat.completion.chunk",
+		"created": created,
+		"model":   model,
+		"choices": []map[string]interface{}{
+			{
+				"index":         0,
+				"delta":         map[string]interface{}{"role": "assistant", "content": message},
+				"finish_reason": "stop",
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", chunk); err != nil {
+		return err
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/robertprast/goop/pkg/utils"
+)
+
+func TestDegradedResponseWhenBreakerOpen(t *testing.T) {
+	var upstreamCalls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		http.Error(w, `{"error":{"message":"overloaded"}}`, http.StatusInternalServerError)
+	}))
+	defer upstream.Close()
+
+	config := &utils.Config{}
+	config.CircuitBreaker = utils.CircuitBreakerConfig{Enabled: true, ErrorRatio: 0.5, MinRequests: 2, Window: time.Minute, Cooldown: time.Hour}
+	config.DegradedMode = utils.DegradedModeConfig{Enabled: true, Message: "Back soon."}
+	handler, _ := newTestHandler(t, config, map[string]string{
+		"ollama":            "base_url: " + upstream.URL,
+		"openai_compatible": "- name: vllm\n  base_url: " + upstream.URL + "/v1\n  api_key: x",
+	})
+
+	// tripBreaker relays the upstream's own failures until the model's engine breaker opens
+	tripBreaker := func(model string) {
+		t.Helper()
+		for i := 0; i < 2; i++ {
+			if rec := postChat(t, handler, chatBody(model)); rec.Code != http.StatusInternalServerError {
+				t.Fatalf("%s request %d status = %d, want the upstream's %d", model, i, rec.Code, http.StatusInternalServerError)
+			}
+		}
+	}
+
+	// Only ollama is open, vllm is still healthy so ollama requests are paused, not degraded
+	tripBreaker("ollama/llama3")
+	rec := postChat(t, handler, chatBody("ollama/llama3"))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("status = %d, Retry-After = %q, want a 503 with Retry-After while another engine is healthy", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec.Header().Get("X-Goop-Degraded") != "" {
+		t.Error("degraded response served while another engine is healthy")
+	}
+
+	// Every engine is open now
+	tripBreaker("vllm/llama3")
+	rec = postChat(t, handler, chatBody("ollama/llama3"))
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Goop-Degraded") != "true" {
+		t.Fatalf("status = %d, X-Goop-Degraded = %q, want a degraded 200", rec.Code, rec.Header().Get("X-Goop-Degraded"))
+	}
+	var resp struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("error decoding degraded response: %v", err)
+	}
+	if resp.Model != "ollama/llama3" || len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "Back soon." || resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("degraded response = %s", rec.Body)
+	}
+
+	rec = postChat(t, handler, `{"model":"vllm/llama3","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	if rec.Header().Get("X-Goop-Degraded") != "true" || rec.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("stream headers = %v, want a degraded event stream", rec.Header())
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `"content":"Back soon."`) || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("degraded stream = %q", body)
+	}
+
+	if n := atomic.LoadInt32(&upstreamCalls); n != 4 {
+		t.Errorf("upstream called %d times, want 4, paused and degraded requests must not reach it", n)
+	}
+}
+
+func TestUpstreamErrorIsNotDegraded(t *testing.T) {
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	config := &utils.Config{}
+	config.DegradedMode = utils.DegradedModeConfig{Enabled: true}
+	handler, _ := newTestHandler(t, config, map[string]string{"ollama": "base_url: " + unreachable.URL})
+
+	rec := postChat(t, handler, chatBody("ollama/llama3"))
+	if rec.Code != http.StatusBadGateway || rec.Header().Get("X-Goop-Degraded") != "" {
+		t.Errorf("status = %d, X-Goop-Degraded = %q, want a plain 502 for a single upstream error", rec.Code, rec.Header().Get("X-Goop-Degraded"))
+	}
+}
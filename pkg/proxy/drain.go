@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// streamFinalizeTimeout is how long streams get to write their final chunk once told to stop
+const streamFinalizeTimeout = 500 * time.Millisecond
+
+// StreamTracker tracks in-flight streaming chat completions so shutdown can
+// wait for them instead of cutting them off mid-stream
+type StreamTracker struct {
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewStreamTracker creates a tracker for in-flight streams
+func NewStreamTracker() *StreamTracker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &StreamTracker{ctx: ctx, cancel: cancel}
+}
+
+// Track registers a stream. The returned context is cancelled when either the
+// request ends or the tracker is told to stop streams, and done must be called
+// once the stream has finished writing.
+func (t *StreamTracker) Track(ctx context.Context) (streamCtx context.Context, done func()) {
+	t.wg.Add(1)
+	streamCtx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(t.ctx, cancel)
+	return streamCtx, func() {
+		stop()
+		cancel()
+		t.wg.Done()
+	}
+}
+
+// Stopping reports whether streams have been told to stop for shutdown
+func (t *StreamTracker) Stopping() bool {
+	return t.ctx.Err() != nil
+}
+
+// Drain waits for in-flight streams to finish on their own until ctx expires,
+// then tells the remaining ones to stop and gives them a moment to flush a final chunk
+func (t *StreamTracker) Drain(ctx context.Context) {
+	finished := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return
+	case <-ctx.Done():
+	}
+
+	t.cancel()
+	select {
+	case <-finished:
+	case <-time.After(streamFinalizeTimeout):
+	}
+}
@@ -0,0 +1,204 @@
+package proxy
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/robertprast/goop/pkg/engine"
+	"github.com/robertprast/goop/pkg/engine/azure"
+	"github.com/robertprast/goop/pkg/engine/bedrock"
+	"github.com/robertprast/goop/pkg/engine/cohere"
+	"github.com/robertprast/goop/pkg/engine/mock"
+	"github.com/robertprast/goop/pkg/engine/ollama"
+	"github.com/robertprast/goop/pkg/engine/openai"
+	"github.com/robertprast/goop/pkg/engine/vertex"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+var errEngineNotFound = errors.New("engine not found")
+
+// EngineCache keeps one engine instance per configured engine so engines aren't
+// rebuilt on every request. An engine is rebuilt when its config changes, which
+// lets reloaded configs (e.g. rotated API keys) take effect without a restart.
+type EngineCache struct {
+	mu      sync.Mutex
+	configs map[string]string
+	// compatible holds the `openai_compatible` backends keyed by their prefix
+	compatible map[string]openai.CompatibleConfig
+	engines    map[string]engine.Engine
+	// onReload is called after every Reload, e.g. to drop state derived from the old engines
+	onReload []func()
+}
+
+// NewEngineCache creates a cache for the given engine configs
+func NewEngineCache(configs map[string]string) *EngineCache {
+	return &EngineCache{
+		configs:    configs,
+		compatible: compatibleConfigs(configs),
+		engines:    make(map[string]engine.Engine),
+	}
+}
+
+// compatibleConfigs registers each `openai_compatible` backend under its prefix.
+// Backends that would shadow a built in engine are skipped.
+func compatibleConfigs(configs map[string]string) map[string]openai.CompatibleConfig {
+	compatible := make(map[string]openai.CompatibleConfig)
+	configStr, ok := configs["openai_compatible"]
+	if !ok {
+		return compatible
+	}
+	backends, err := openai.ParseCompatibleConfigs(configStr)
+	if err != nil {
+		logrus.Errorf("Error loading openai_compatible engines: %v", err)
+		return compatible
+	}
+	for _, backend := range backends {
+		if _, exists := configs[backend.Prefix]; exists {
+			logrus.Errorf("openai_compatible engine %s uses prefix %q of a configured engine, skipping it", backend.Name, backend.Prefix)
+			continue
+		}
+		if _, exists := compatible[backend.Prefix]; exists {
+			logrus.Errorf("openai_compatible engine %s uses duplicate prefix %q, skipping it", backend.Name, backend.Prefix)
+			continue
+		}
+		compatible[backend.Prefix] = backend
+	}
+	return compatible
+}
+
+// Get returns the engine for name, creating it on first use
+func (c *EngineCache) Get(name string) (engine.Engine, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if eng, ok := c.engines[name]; ok {
+		return eng, nil
+	}
+
+	var eng engine.Engine
+	var err error
+	if backend, ok := c.compatible[name]; ok {
+		eng, err = openai.NewOpenAICompatibleEngine(backend)
+	} else if configStr, ok := c.configs[name]; ok {
+		eng, err = createEngine(name, configStr)
+	} else {
+		return nil, errEngineNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.engines[name] = eng
+	return eng, nil
+}
+
+// Config returns the raw config of an engine
+func (c *EngineCache) Config(name string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	configStr, ok := c.configs[name]
+	return configStr, ok
+}
+
+// Names returns the names of all configured engines that are enabled
+func (c *EngineCache) Names() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.configs)+len(c.compatible))
+	for name, configStr := range c.configs {
+		if name != "openai_compatible" && engineEnabled(name, configStr) {
+			names = append(names, name)
+		}
+	}
+	for name := range c.compatible {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Compatible reports whether name is the prefix of an `openai_compatible` backend
+func (c *EngineCache) Compatible(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.compatible[name]
+	return ok
+}
+
+// Reload swaps in new engine configs. Engines whose config changed or was
+// removed are dropped and recreated from the new config on next use.
+func (c *EngineCache) Reload(configs map[string]string) {
+	compatible := compatibleConfigs(configs)
+
+	c.mu.Lock()
+	for name, eng := range c.engines {
+		if backend, ok := c.compatible[name]; ok {
+			if compatible[name] == backend {
+				continue
+			}
+		} else if newConfig, ok := configs[name]; ok && newConfig == c.configs[name] {
+			continue
+		}
+		logrus.Infof("Config for engine %s changed, recreating it on next use", name)
+		if closer, ok := eng.(interface{ Close() }); ok {
+			closer.Close()
+		}
+		delete(c.engines, name)
+	}
+	c.configs = configs
+	c.compatible = compatible
+	onReload := c.onReload
+	c.mu.Unlock()
+
+	for _, fn := range onReload {
+		fn()
+	}
+}
+
+// OnReload registers fn to be called after each Reload
+func (c *EngineCache) OnReload(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onReload = append(c.onReload, fn)
+}
+
+// optInEngines are only created when their config sets `enabled: true`
+var optInEngines = map[string]bool{"bedrock": true, "vertex": true, "mock": true}
+
+// engineEnabled reports whether the engine's config enables it
+func engineEnabled(name, configStr string) bool {
+	if !optInEngines[name] {
+		return true
+	}
+	var config struct {
+		Enabled bool `yaml:"enabled"`
+	}
+	if err := yaml.Unmarshal([]byte(configStr), &config); err != nil {
+		return false
+	}
+	return config.Enabled
+}
+
+// createEngine builds the engine for name from its config
+func createEngine(name, configStr string) (engine.Engine, error) {
+	switch name {
+	case "openai":
+		return openai.NewOpenAIEngineWithConfig(configStr)
+	case "azure":
+		return azure.NewAzureOpenAIEngineWithConfig(configStr)
+	case "bedrock":
+		return bedrock.NewBedrockEngine(configStr)
+	case "vertex":
+		return vertex.NewVertexEngine(configStr)
+	case "ollama":
+		return ollama.NewOllamaEngine(configStr)
+	case "mock":
+		return mock.NewMockEngine(configStr)
+	case "cohere":
+		return cohere.NewCohereEngine(configStr)
+	default:
+		return nil, errEngineNotFound
+	}
+}
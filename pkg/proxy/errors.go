@@ -0,0 +1,8 @@
+package proxy
+
+import (
+	"errors"
+)
+
+// errUnsupportedModel is returned by selectEngine when no engine serves the model
+var errUnsupportedModel = errors.New("unsupported model")
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/robertprast/goop/pkg/openai_schema"
+	"github.com/sirupsen/logrus"
+)
+
+// RequestTransformer inspects a chat completion request after routing and engine
+// selection, before it's transformed for the engine. It may modify the request,
+// or reject it by returning an error, which the client receives as a 400.
+type RequestTransformer interface {
+	TransformRequest(ctx context.Context, req *openai_schema.IncomingChatCompletionRequest) error
+}
+
+// ResponseTransformer inspects the upstream response of a chat completion
+// before it's sent to the client. It may modify the response, e.g. its
+// headers or body, or fail it by returning an error, answered with a 502.
+type ResponseTransformer interface {
+	TransformResponse(ctx context.Context, model string, resp *http.Response) error
+}
+
+var (
+	requestTransformers  []RequestTransformer
+	responseTransformers []ResponseTransformer
+)
+
+// RegisterRequestTransformer adds t to the chat completion request hooks.
+// It must be called before NewHandler, hooks run in registration order.
+func RegisterRequestTransformer(t RequestTransformer) {
+	requestTransformers = append(requestTransformers, t)
+}
+
+// RegisterResponseTransformer adds t to the chat completion response hooks.
+// It must be called before NewHandler, hooks run in registration order.
+func RegisterResponseTransformer(t ResponseTransformer) {
+	responseTransformers = append(responseTransformers, t)
+}
+
+// systemPromptPrefix puts a configured system prompt ahead of the client's.
+// It's merged into a leading client system message so providers accepting a
+// single system message still get both.
+type systemPromptPrefix struct {
+	prefix  string
+	byModel map[string]string
+}
+
+func (s systemPromptPrefix) TransformRequest(ctx context.Context, req *openai_schema.IncomingChatCompletionRequest) error {
+	prefix := s.prefix
+	if override, ok := s.byModel[req.Model]; ok {
+		prefix = override
+	}
+	if prefix == "" {
+		return nil
+	}
+
+	if len(req.Messages) > 0 && req.Messages[0].Role == "system" {
+		first := &req.Messages[0]
+		switch {
+		case first.ContentParts != nil:
+			parts := append([]openai_schema.ContentPart{{Type: "text", Text: prefix}}, first.ContentParts...)
+			first.ContentParts = parts
+			return nil
+		case first.Content != nil && *first.Content != "":
+			merged := prefix + "\n\n" + *first.Content
+			first.Content = &merged
+			return nil
+		}
+	}
+
+	system := openai_schema.ChatMessage{Role: "system", Content: &prefix}
+	req.Messages = append([]openai_schema.ChatMessage{system}, req.Messages...)
+	return nil
+}
+
+// maxTokensCap limits the output tokens of every request to request.max_tokens_cap
+type maxTokensCap struct {
+	limit int
+}
+
+func (c maxTokensCap) TransformRequest(ctx context.Context, req *openai_schema.IncomingChatCompletionRequest) error {
+	if req.MaxTokens == nil && req.MaxCompletionTokens == nil {
+		limit := c.limit
+		req.MaxTokens = &limit
+		return nil
+	}
+	for _, value := range []**int{&req.MaxTokens, &req.MaxCompletionTokens} {
+		if *value != nil && **value > c.limit {
+			logrus.Debugf("Capping output tokens of %s from %d to %d", req.Model, **value, c.limit)
+			limit := c.limit
+			*value = &limit
+		}
+	}
+	return nil
+}
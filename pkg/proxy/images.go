@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/robertprast/goop/pkg/openai_schema"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/robertprast/goop/pkg/engine/bedrock"
+	bedrockproxy "github.com/robertprast/goop/pkg/transformers/bedrock"
+	"github.com/robertprast/goop/pkg/utils"
+)
+
+// ImageGenerationEngine is implemented by engines that serve /v1/images/generations
+type ImageGenerationEngine interface {
+	// TransformImageGenerationRequest gets the raw body along with its parsed
+	// form, so passthroughs can forward fields the schema doesn't cover
+	TransformImageGenerationRequest(ctx context.Context, body []byte, reqBody openai_schema.ImageGenerationRequest) ([]byte, error)
+	HandleImageGenerationRequest(ctx context.Context, model string, transformedBody []byte) (*http.Response, error)
+	SendImageGenerationResponse(ctx context.Context, resp *http.Response, w http.ResponseWriter) error
+}
+
+// handleImageGenerations handles the /openai-proxy/v1/images/generations endpoint
+func (h *OpenAIProxyHandler) handleImageGenerations(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if isBodyTooLarge(err) {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "body_too_large").Inc()
+		utils.WriteOpenAIError(w, http.StatusRequestEntityTooLarge, utils.ErrTypeInvalidRequest, "request_too_large", "Request body too large")
+		return
+	}
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "read_body_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "", "Error reading request body")
+		return
+	}
+
+	var reqBody openai_schema.ImageGenerationRequest
+	if err := json.Unmarshal(body, &reqBody); err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "unmarshal_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "invalid_json", fmt.Sprintf("Error parsing request body: %v", err))
+		return
+	}
+	if reqBody.Model == "" || reqBody.Prompt == "" {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "invalid_request").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "", "'model' and 'prompt' are required")
+		return
+	}
+	reqBody.Model = h.applyDefaultEngine(reqBody.Model)
+	if entry := accessLogFromContext(r.Context()); entry != nil {
+		entry.Model = reqBody.Model
+		entry.Engine, _, _ = strings.Cut(reqBody.Model, "/")
+	}
+
+	proxy, err := h.selectImageEngine(reqBody.Model)
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "engine_selection_error").Inc()
+		if errors.Is(err, errUnsupportedModel) || errors.Is(err, errEngineNotFound) {
+			utils.WriteOpenAIError(w, http.StatusNotFound, utils.ErrTypeInvalidRequest, "model_not_found", err.Error())
+		} else {
+			utils.WriteOpenAIError(w, http.StatusInternalServerError, utils.ErrTypeAPI, "", fmt.Sprintf("Error selecting engine: %v", err))
+		}
+		return
+	}
+
+	transformedBody, err := proxy.TransformImageGenerationRequest(r.Context(), body, reqBody)
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "transform_request_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "", fmt.Sprintf("Error transforming request: %v", err))
+		return
+	}
+
+	resp, err := proxy.HandleImageGenerationRequest(r.Context(), reqBody.Model, transformedBody)
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "handle_request_error").Inc()
+		h.logger.Infof("Error generating images with %s: %v", reqBody.Model, err)
+		utils.WriteOpenAIError(w, http.StatusBadGateway, utils.ErrTypeAPI, "upstream_error", fmt.Sprintf("Error processing request: %v", err))
+		return
+	}
+
+	if err := proxy.SendImageGenerationResponse(r.Context(), resp, w); err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "send_response_error").Inc()
+		h.logger.Errorf("Error sending image response: %v", err)
+	}
+}
+
+// selectImageEngine returns the image generation engine for model. Bedrock
+// goes through InvokeModel, openai and openai_compatible engines are passed through.
+func (h *OpenAIProxyHandler) selectImageEngine(model string) (ImageGenerationEngine, error) {
+	prefix, _, _ := strings.Cut(model, "/")
+	switch {
+	case prefix == "bedrock":
+		eng, err := h.engines.Get("bedrock")
+		if err != nil {
+			h.logger.Errorf("Error creating Bedrock engine: %v", err)
+			return nil, err
+		}
+		return &bedrockproxy.BedrockProxy{BedrockEngine: eng.(*bedrock.BedrockEngine)}, nil
+	case prefix == "openai" || h.engines.Compatible(prefix):
+		return h.openAIPassthrough(prefix, model)
+	default:
+		return nil, fmt.Errorf("%w: %s does not support image generation", errUnsupportedModel, model)
+	}
+}
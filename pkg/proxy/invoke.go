@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/robertprast/goop/pkg/engine/bedrock"
+	bedrockproxy "github.com/robertprast/goop/pkg/transformers/bedrock"
+	"github.com/robertprast/goop/pkg/utils"
+)
+
+// invokeRequest is the body of /openai-proxy/v1/bedrock/invoke. Input is the
+// model-native request, forwarded to InvokeModel as is.
+type invokeRequest struct {
+	Model string          `json:"model"`
+	Input json.RawMessage `json:"input"`
+}
+
+// handleBedrockInvoke handles the /openai-proxy/v1/bedrock/invoke endpoint,
+// a signed passthrough to Bedrock InvokeModel for models converse doesn't support
+func (h *OpenAIProxyHandler) handleBedrockInvoke(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if isBodyTooLarge(err) {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "body_too_large").Inc()
+		utils.WriteOpenAIError(w, http.StatusRequestEntityTooLarge, utils.ErrTypeInvalidRequest, "request_too_large", "Request body too large")
+		return
+	}
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "read_body_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "", "Error reading request body")
+		return
+	}
+
+	var reqBody invokeRequest
+	if err := json.Unmarshal(body, &reqBody); err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "unmarshal_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "invalid_json", fmt.Sprintf("Error parsing request body: %v", err))
+		return
+	}
+	if !strings.HasPrefix(reqBody.Model, "bedrock/") || len(reqBody.Input) == 0 {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "invalid_request").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "",
+			"'model' must be a bedrock/ model and 'input' the model's native request body")
+		return
+	}
+	if entry := accessLogFromContext(r.Context()); entry != nil {
+		entry.Model = reqBody.Model
+		entry.Engine = "bedrock"
+	}
+
+	eng, err := h.engines.Get("bedrock")
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "engine_selection_error").Inc()
+		h.logger.Errorf("Error creating Bedrock engine: %v", err)
+		utils.WriteOpenAIError(w, http.StatusNotFound, utils.ErrTypeInvalidRequest, "model_not_found", "Bedrock engine is not configured")
+		return
+	}
+	proxy := &bedrockproxy.BedrockProxy{BedrockEngine: eng.(*bedrock.BedrockEngine)}
+
+	resp, err := proxy.HandleInvokeRequest(r.Context(), reqBody.Model, reqBody.Input)
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "handle_request_error").Inc()
+		h.logger.Infof("Error invoking %s: %v", reqBody.Model, err)
+		utils.WriteOpenAIError(w, http.StatusBadGateway, utils.ErrTypeAPI, "upstream_error", fmt.Sprintf("Error processing request: %v", err))
+		return
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(resp.Body)
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		h.logger.Errorf("Error sending invoke response: %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/robertprast/goop/pkg/utils"
+)
+
+// defaultMaxRequestBytes caps request bodies when server.max_request_bytes isn't set
+const defaultMaxRequestBytes = 10 << 20
+
+// headerLimitMiddleware rejects requests carrying more than maxCount header
+// values with 431. Total header size is bounded by the server's MaxHeaderBytes.
+func headerLimitMiddleware(maxCount int) Middleware {
+	return func(next http.Handler) http.Handler {
+		if maxCount <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			count := 0
+			for _, values := range r.Header {
+				count += len(values)
+			}
+			if count > maxCount {
+				utils.WriteOpenAIError(w, http.StatusRequestHeaderFieldsTooLarge, utils.ErrTypeInvalidRequest, "headers_too_large", "Request header fields too large")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bodyLimitMiddleware caps request bodies at maxBytes. Requests declaring a
+// larger Content-Length are rejected with 413 up front, others fail with a
+// *http.MaxBytesError once the limit is read.
+func bodyLimitMiddleware(maxBytes int64) Middleware {
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxRequestBytes
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				utils.WriteOpenAIError(w, http.StatusRequestEntityTooLarge, utils.ErrTypeInvalidRequest, "request_too_large", "Request body too large")
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isBodyTooLarge reports whether err comes from reading past the body limit
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHeaderLimitMiddleware(t *testing.T) {
+	reached := false
+	handler := headerLimitMiddleware(5)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+
+	tests := []struct {
+		name    string
+		headers int
+		want    int
+	}{
+		{"at the limit", 5, http.StatusOK},
+		{"over the limit", 6, http.StatusRequestHeaderFieldsTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached = false
+			req := httptest.NewRequest(http.MethodPost, "/openai-proxy/v1/chat/completions", nil)
+			for i := 0; i < tt.headers; i++ {
+				req.Header.Set(fmt.Sprintf("X-Custom-%d", i), "v")
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if reached != (tt.want == http.StatusOK) {
+				t.Errorf("handler reached = %t, want %t", reached, tt.want == http.StatusOK)
+			}
+		})
+	}
+}
+
+func TestHeaderLimitMiddlewareCountsRepeatedValues(t *testing.T) {
+	handler := headerLimitMiddleware(3)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/openai-proxy/v1/models", nil)
+	for i := 0; i < 4; i++ {
+		req.Header.Add("X-Repeated", "v")
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("status = %d, want %d for one header repeated past the limit", rec.Code, http.StatusRequestHeaderFieldsTooLarge)
+	}
+}
+
+func TestHeaderLimitMiddlewareDisabled(t *testing.T) {
+	handler := headerLimitMiddleware(0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/openai-proxy/v1/models", nil)
+	for i := 0; i < 200; i++ {
+		req.Header.Set(fmt.Sprintf("X-Custom-%d", i), "v")
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d with the limit disabled, want %d", rec.Code, http.StatusOK)
+	}
+}
@@ -1,10 +1,27 @@
 package proxy
 
 import (
-	"github.com/prometheus/client_golang/prometheus"
+	"fmt"
 	"net/http"
+	"regexp"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
 )
 
+// maxMetadataLabelValueLen bounds the size of metadata values used as label values
+const maxMetadataLabelValueLen = 64
+
+// maxMetadataLabelValues bounds the distinct values tracked per metadata key,
+// values first seen after that are counted as otherMetadataValue
+const maxMetadataLabelValues = 50
+
+const otherMetadataValue = "other"
+
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
 // Middleware defines the signature for middleware functions
 type Middleware func(http.Handler) http.Handler
 
@@ -78,11 +95,34 @@ type OpenaiProxyMetrics struct {
 	ErrorsTotal             *prometheus.CounterVec
 	ChatCompletions         *prometheus.CounterVec
 	ChatCompletionDurations *prometheus.HistogramVec
+	// ChatCompletionErrors counts chat completions answered with a 4xx or 5xx by model, engine and status class
+	ChatCompletionErrors *prometheus.CounterVec
+	// TTFT is the time from request receipt to the first streamed chunk by model
+	TTFT *prometheus.HistogramVec
+	// CircuitBreakerTransitions counts engine circuit breaker state changes
+	CircuitBreakerTransitions *prometheus.CounterVec
+	// EngineQueueDepth is the number of requests waiting for an engine concurrency slot
+	EngineQueueDepth *prometheus.GaugeVec
+
+	// ChatCompletionsByMetadata is only registered when metadata labels are configured
+	ChatCompletionsByMetadata *prometheus.CounterVec
+	metadataKeys              []string
+	metadataMu                sync.Mutex
+	// metadataValues holds the values seen per metadata key, up to maxMetadataLabelValues
+	metadataValues map[string]map[string]struct{}
+
+	registerer prometheus.Registerer
 }
 
 // NewOpenaiProxyMetrics initializes Prometheus metrics for the OpenAI proxy
 func NewOpenaiProxyMetrics() *OpenaiProxyMetrics {
+	return newOpenaiProxyMetrics(prometheus.DefaultRegisterer)
+}
+
+// newOpenaiProxyMetrics registers the metrics with registerer
+func newOpenaiProxyMetrics(registerer prometheus.Registerer) *OpenaiProxyMetrics {
 	m := &OpenaiProxyMetrics{
+		registerer: registerer,
 		RequestsTotal: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "openai_proxy_requests_total",
@@ -115,21 +155,129 @@ func NewOpenaiProxyMetrics() *OpenaiProxyMetrics {
 		ChatCompletionDurations: prometheus.NewHistogramVec(
 			prometheus.HistogramOpts{
 				Name:    "openai_proxy_chat_completion_duration_seconds",
-				Help:    "Duration of chat completion requests in seconds",
+				Help:    "Duration of chat completion requests in seconds by model, engine and status class",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"model", "engine", "status_class"},
+		),
+		ChatCompletionErrors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "openai_proxy_chat_completion_errors_total",
+				Help: "Total number of chat completion requests answered with an error status by model, engine and status class",
+			},
+			[]string{"model", "engine", "status_class"},
+		),
+		TTFT: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "openai_proxy_ttft_seconds",
+				Help:    "Time from request receipt to the first streamed chat completion chunk in seconds",
 				Buckets: prometheus.DefBuckets,
 			},
 			[]string{"model"},
 		),
+		CircuitBreakerTransitions: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "openai_proxy_circuit_breaker_transitions_total",
+				Help: "Total number of circuit breaker state transitions by engine and new state",
+			},
+			[]string{"engine", "state"},
+		),
+		EngineQueueDepth: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "openai_proxy_engine_queue_depth",
+				Help: "Number of requests waiting for a concurrency slot by engine",
+			},
+			[]string{"engine"},
+		),
 	}
 
 	// Register metrics
-	prometheus.MustRegister(
+	registerer.MustRegister(
 		m.RequestsTotal,
 		m.RequestDuration,
 		m.ErrorsTotal,
 		m.ChatCompletions,
 		m.ChatCompletionDurations,
+		m.ChatCompletionErrors,
+		m.TTFT,
+		m.CircuitBreakerTransitions,
+		m.EngineQueueDepth,
 	)
 
 	return m
 }
+
+// EnableMetadataLabels registers a chat completion counter labeled by model and
+// the allowlisted request metadata keys. Keys that aren't valid Prometheus label
+// names and repeated keys are skipped. Only the allowlist is ever used and each
+// key's values are capped so cardinality stays bounded.
+func (m *OpenaiProxyMetrics) EnableMetadataLabels(keys []string) {
+	labels := []string{"model"}
+	m.metadataValues = make(map[string]map[string]struct{})
+	for _, key := range keys {
+		if !labelNameRe.MatchString(key) {
+			logrus.Warnf("Skipping metadata label %q: not a valid label name", key)
+			continue
+		}
+		if _, ok := m.metadataValues[key]; ok {
+			logrus.Warnf("Skipping metadata label %q: listed more than once", key)
+			continue
+		}
+		m.metadataValues[key] = make(map[string]struct{})
+		m.metadataKeys = append(m.metadataKeys, key)
+		labels = append(labels, "metadata_"+key)
+	}
+	if len(m.metadataKeys) == 0 {
+		return
+	}
+
+	m.ChatCompletionsByMetadata = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "openai_proxy_chat_completions_by_metadata_total",
+			Help: "Total number of chat completion requests by allowlisted request metadata",
+		},
+		labels,
+	)
+	m.registerer.MustRegister(m.ChatCompletionsByMetadata)
+}
+
+// ObserveMetadata counts a chat completion against its allowlisted metadata values
+func (m *OpenaiProxyMetrics) ObserveMetadata(model string, metadata map[string]string) {
+	if m.ChatCompletionsByMetadata == nil {
+		return
+	}
+	values := []string{model}
+	m.metadataMu.Lock()
+	for _, key := range m.metadataKeys {
+		values = append(values, m.metadataValue(key, metadata[key]))
+	}
+	m.metadataMu.Unlock()
+	m.ChatCompletionsByMetadata.WithLabelValues(values...).Inc()
+}
+
+// metadataValue returns the label value for a metadata value, truncated, or
+// otherMetadataValue once the key has maxMetadataLabelValues other values
+func (m *OpenaiProxyMetrics) metadataValue(key, value string) string {
+	if len(value) > maxMetadataLabelValueLen {
+		// Cut on a rune boundary, label values must be valid UTF-8
+		cut := maxMetadataLabelValueLen
+		for cut > 0 && !utf8.RuneStart(value[cut]) {
+			cut--
+		}
+		value = value[:cut]
+	}
+	seen := m.metadataValues[key]
+	if _, ok := seen[value]; ok || value == "" {
+		return value
+	}
+	if len(seen) >= maxMetadataLabelValues {
+		return otherMetadataValue
+	}
+	seen[value] = struct{}{}
+	return value
+}
+
+// statusClass groups an HTTP status code into its class, e.g. 503 -> "5xx"
+func statusClass(code int) string {
+	return fmt.Sprintf("%dxx", code/100)
+}
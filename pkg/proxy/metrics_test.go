@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/robertprast/goop/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMetadataLabels(t *testing.T) {
+	m := newOpenaiProxyMetrics(prometheus.NewRegistry())
+	// Duplicates and invalid label names are skipped instead of failing registration
+	m.EnableMetadataLabels([]string{"team", "team", "not-valid", "app"})
+
+	m.ObserveMetadata("gpt-4o", map[string]string{"team": "search", "app": "chat", "secret": "x"})
+	m.ObserveMetadata("gpt-4o", map[string]string{"team": "search"})
+
+	want := `
+# HELP openai_proxy_chat_completions_by_metadata_total Total number of chat completion requests by allowlisted request metadata
+# TYPE openai_proxy_chat_completions_by_metadata_total counter
+openai_proxy_chat_completions_by_metadata_total{metadata_app="",metadata_team="search",model="gpt-4o"} 1
+openai_proxy_chat_completions_by_metadata_total{metadata_app="chat",metadata_team="search",model="gpt-4o"} 1
+`
+	if err := testutil.CollectAndCompare(m.ChatCompletionsByMetadata, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMetadataLabelValuesAreCapped(t *testing.T) {
+	m := newOpenaiProxyMetrics(prometheus.NewRegistry())
+	m.EnableMetadataLabels([]string{"user"})
+
+	for i := 0; i < maxMetadataLabelValues+10; i++ {
+		m.ObserveMetadata("gpt-4o", map[string]string{"user": fmt.Sprintf("user-%d", i)})
+	}
+	// A value seen before the cap keeps its own series
+	m.ObserveMetadata("gpt-4o", map[string]string{"user": "user-0"})
+
+	if got := testutil.CollectAndCount(m.ChatCompletionsByMetadata); got != maxMetadataLabelValues+1 {
+		t.Errorf("series = %d, want %d", got, maxMetadataLabelValues+1)
+	}
+	if got := testutil.ToFloat64(m.ChatCompletionsByMetadata.WithLabelValues("gpt-4o", otherMetadataValue)); got != 10 {
+		t.Errorf("other = %v, want 10", got)
+	}
+	if got := testutil.ToFloat64(m.ChatCompletionsByMetadata.WithLabelValues("gpt-4o", "user-0")); got != 2 {
+		t.Errorf("user-0 = %v, want 2", got)
+	}
+}
+
+func TestMetadataLabelValuesTruncateOnRuneBoundary(t *testing.T) {
+	m := newOpenaiProxyMetrics(prometheus.NewRegistry())
+	m.EnableMetadataLabels([]string{"team", "app"})
+
+	// 3 and 4 byte runes that don't end on maxMetadataLabelValueLen
+	cjk := strings.Repeat("検索", 20)
+	emoji := "a" + strings.Repeat("🚀", 20)
+	m.ObserveMetadata("gpt-4o", map[string]string{"team": cjk, "app": emoji})
+
+	for key, want := range map[string]string{"team": cjk, "app": emoji} {
+		got := m.metadataValue(key, want)
+		if !utf8.ValidString(got) || len(got) > maxMetadataLabelValueLen || !strings.HasPrefix(want, got) {
+			t.Errorf("%s value = %q, want a valid UTF-8 prefix of at most %d bytes", key, got, maxMetadataLabelValueLen)
+		}
+		if len(got) < maxMetadataLabelValueLen-utf8.UTFMax {
+			t.Errorf("%s value = %d bytes, cut more than one rune short of %d", key, len(got), maxMetadataLabelValueLen)
+		}
+	}
+}
+
+func TestMetadataObservedForSelectedModel(t *testing.T) {
+	config := &utils.Config{}
+	config.Metrics.MetadataLabels = []string{"team"}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	metrics := newOpenaiProxyMetrics(prometheus.NewRegistry())
+	handler := NewHandler(config, NewEngineCache(map[string]string{"mock": "enabled: true"}), logger, metrics, NewStreamTracker())
+
+	// Requests without an engine don't get a series for the client's model
+	if rec := postChat(t, handler, `{"model":"nope/x","metadata":{"team":"search"},"messages":[{"role":"user","content":"hi"}]}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := postChat(t, handler, `{"model":"mock/echo","metadata":{"team":"search"},"messages":[{"role":"user","content":"hi"}]}`); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	expected := `
+# HELP openai_proxy_chat_completions_by_metadata_total Total number of chat completion requests by allowlisted request metadata
+# TYPE openai_proxy_chat_completions_by_metadata_total counter
+openai_proxy_chat_completions_by_metadata_total{metadata_team="search",model="mock/echo"} 1
+`
+	if err := testutil.CollectAndCompare(metrics.ChatCompletionsByMetadata, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
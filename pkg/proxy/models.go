@@ -0,0 +1,209 @@
+package proxy
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robertprast/goop/pkg/engine"
+	"github.com/robertprast/goop/pkg/openai_schema"
+)
+
+// defaultModelCacheTTL is how long an engine's model list is reused before it is fetched again
+const defaultModelCacheTTL = 5 * time.Minute
+
+// modelListTimeout bounds how long /v1/models waits for the engines' model lists
+const modelListTimeout = 10 * time.Second
+
+// maxModelSuggestions caps the close matches returned for an unknown model
+const maxModelSuggestions = 3
+
+type cachedModels struct {
+	models  []openai_schema.Model
+	fetched time.Time
+}
+
+// modelCache caches each engine's ListModels output, since listing usually
+// means a request to the provider
+type modelCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cachedModels
+}
+
+func newModelCache(ttl time.Duration) *modelCache {
+	if ttl <= 0 {
+		ttl = defaultModelCacheTTL
+	}
+	return &modelCache{
+		ttl:     ttl,
+		entries: make(map[string]cachedModels),
+	}
+}
+
+// get returns the cached models of the named engine, listing them when the cache is stale
+func (c *modelCache) get(name string, eng engine.Engine) ([]openai_schema.Model, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok && time.Since(entry.fetched) < c.ttl {
+		return entry.models, nil
+	}
+
+	models, err := eng.ListModels()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[name] = cachedModels{models: models, fetched: time.Now()}
+	c.mu.Unlock()
+	return models, nil
+}
+
+// invalidate drops every cached model list so the next get lists them again
+func (c *modelCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]cachedModels)
+}
+
+// listModels lists the models of the named engines concurrently and returns them
+// sorted by id, with the names of the engines that failed or didn't answer
+// within modelListTimeout
+func (h *OpenAIProxyHandler) listModels(names []string) ([]openai_schema.Model, []string) {
+	type result struct {
+		name   string
+		models []openai_schema.Model
+		err    error
+	}
+	// Buffered so engines answering after the timeout don't block
+	results := make(chan result, len(names))
+	for _, name := range names {
+		go func(name string) {
+			eng, err := h.engines.Get(name)
+			if err != nil {
+				results <- result{name: name, err: err}
+				return
+			}
+			models, err := h.models.get(name, eng)
+			results <- result{name: name, models: models, err: err}
+		}(name)
+	}
+
+	models := []openai_schema.Model{}
+	var failed []string
+	answered := make(map[string]bool, len(names))
+	timeout := time.After(modelListTimeout)
+	for len(answered) < len(names) {
+		select {
+		case res := <-results:
+			answered[res.name] = true
+			if res.err != nil {
+				h.logger.Errorf("Error listing %s models: %v", res.name, res.err)
+				failed = append(failed, res.name)
+				continue
+			}
+			h.logger.Debugf("Got the models from %s %v", res.name, res.models)
+			models = append(models, res.models...)
+		case <-timeout:
+			for _, name := range names {
+				if !answered[name] {
+					h.logger.Errorf("Timed out listing %s models", name)
+					failed = append(failed, name)
+				}
+			}
+			sortModels(models)
+			return models, failed
+		}
+	}
+	sortModels(models)
+	return models, failed
+}
+
+// filterModalities returns the models supporting the input and output modality.
+// An empty modality matches any model, models that don't report modalities never match a filter.
+func filterModalities(models []openai_schema.Model, input, output string) []openai_schema.Model {
+	filtered := []openai_schema.Model{}
+	for _, m := range models {
+		if input != "" && !slices.Contains(m.InputModalities, strings.ToLower(input)) {
+			continue
+		}
+		if output != "" && !slices.Contains(m.OutputModalities, strings.ToLower(output)) {
+			continue
+		}
+		filtered = append(filtered, m)
+	}
+	return filtered
+}
+
+// sortModels sorts models by id so the list order doesn't depend on which engine answered first
+func sortModels(models []openai_schema.Model) {
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].ID < models[j].ID
+	})
+}
+
+// modelMatches reports whether the listed model id names the requested model.
+// Ollama lists untagged models with a :latest tag.
+func modelMatches(id, model string) bool {
+	return id == model || strings.TrimSuffix(id, ":latest") == model
+}
+
+// suggestModels returns the listed model ids closest to model by edit distance.
+// The engine prefix is ignored since every listed model shares it.
+func suggestModels(model string, models []openai_schema.Model) []string {
+	type candidate struct {
+		id       string
+		distance int
+	}
+	name := modelName(model)
+	maxDistance := max(len(name)/2, 1)
+	var candidates []candidate
+	for _, m := range models {
+		listed := strings.TrimSuffix(modelName(m.ID), ":latest")
+		if d := levenshtein(name, listed); d <= maxDistance {
+			candidates = append(candidates, candidate{id: m.ID, distance: d})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+
+	var suggestions []string
+	for i := 0; i < len(candidates) && i < maxModelSuggestions; i++ {
+		suggestions = append(suggestions, candidates[i].id)
+	}
+	return suggestions
+}
+
+// modelName strips the engine prefix from a model id
+func modelName(model string) string {
+	if _, name, found := strings.Cut(model, "/"); found {
+		return name
+	}
+	return model
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/robertprast/goop/pkg/openai_schema"
+	"github.com/robertprast/goop/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestHandler builds the proxy handler around engines created from configs
+func newTestHandler(t *testing.T, config *utils.Config, configs map[string]string) (http.Handler, *EngineCache) {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	engines := NewEngineCache(configs)
+	handler := NewHandler(config, engines, logger, newOpenaiProxyMetrics(prometheus.NewRegistry()), NewStreamTracker())
+	return handler, engines
+}
+
+// newOllamaServer serves an Ollama model list with the given names and answers every chat completion
+func newOllamaServer(t *testing.T, names ...string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			var tags struct {
+				Models []map[string]string `json:"models"`
+			}
+			for _, name := range names {
+				tags.Models = append(tags.Models, map[string]string{"name": name})
+			}
+			_ = json.NewEncoder(w).Encode(tags)
+		case "/v1/chat/completions":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `{"id":"chatcmpl-1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func postChat(t *testing.T, handler http.Handler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/openai-proxy/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func chatBody(model string) string {
+	return fmt.Sprintf(`{"model":%q,"messages":[{"role":"user","content":"hi"}]}`, model)
+}
+
+func TestUnknownModelSuggestsListedModels(t *testing.T) {
+	server := newOllamaServer(t, "llama3", "qwen2")
+	config := &utils.Config{}
+	config.Request.ValidateModels = true
+	handler, _ := newTestHandler(t, config, map[string]string{"ollama": "base_url: " + server.URL})
+
+	rec := postChat(t, handler, chatBody("ollama/lama3"))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusNotFound, rec.Body)
+	}
+	var resp struct {
+		Error struct {
+			Message string `json:"message"`
+			Code    string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	if resp.Error.Code != "model_not_found" {
+		t.Errorf("code = %q, want model_not_found", resp.Error.Code)
+	}
+	if !strings.Contains(resp.Error.Message, "did you mean: ollama/llama3") {
+		t.Errorf("message = %q, want a suggestion of ollama/llama3", resp.Error.Message)
+	}
+}
+
+func TestReloadInvalidatesModelCache(t *testing.T) {
+	before := newOllamaServer(t, "llama3")
+	after := newOllamaServer(t, "qwen2")
+	config := &utils.Config{}
+	config.Request.ValidateModels = true
+	handler, engines := newTestHandler(t, config, map[string]string{"ollama": "base_url: " + before.URL})
+
+	if rec := postChat(t, handler, chatBody("ollama/qwen2")); rec.Code != http.StatusNotFound {
+		t.Fatalf("status before reload = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	engines.Reload(map[string]string{"ollama": "base_url: " + after.URL})
+
+	if rec := postChat(t, handler, chatBody("ollama/qwen2")); rec.Code != http.StatusOK {
+		t.Fatalf("status after reload = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+}
+
+// slowEngine answers ListModels after delay, with err if set
+type slowEngine struct {
+	name  string
+	delay time.Duration
+	err   error
+}
+
+func (e *slowEngine) Name() string                               { return e.name }
+func (e *slowEngine) IsAllowedPath(string) bool                  { return false }
+func (e *slowEngine) ModifyRequest(*http.Request)                {}
+func (e *slowEngine) ResponseCallback(*http.Response, io.Reader) {}
+
+func (e *slowEngine) ListModels() ([]openai_schema.Model, error) {
+	time.Sleep(e.delay)
+	if e.err != nil {
+		return nil, e.err
+	}
+	return []openai_schema.Model{{ID: e.name + "/model", Object: "model"}}, nil
+}
+
+func TestListModelsConcurrently(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	h := newTestProxyHandler(&utils.Config{}, nil)
+	for _, eng := range []*slowEngine{
+		{name: "a", delay: delay},
+		{name: "b", delay: delay},
+		{name: "c", delay: delay},
+		{name: "broken", delay: delay / 2, err: errors.New("upstream unavailable")},
+	} {
+		h.engines.engines[eng.name] = eng
+	}
+
+	start := time.Now()
+	models, failed := h.listModels([]string{"a", "b", "broken", "c"})
+	elapsed := time.Since(start)
+
+	// Listed one after another the engines would take 3.5 delays
+	if elapsed >= 2*delay {
+		t.Errorf("listModels took %s, want about the slowest engine's %s", elapsed, delay)
+	}
+	var ids []string
+	for _, m := range models {
+		ids = append(ids, m.ID)
+	}
+	if want := []string{"a/model", "b/model", "c/model"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("models = %v, want %v", ids, want)
+	}
+	if want := []string{"broken"}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("failed = %v, want %v", failed, want)
+	}
+}
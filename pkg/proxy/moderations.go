@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/robertprast/goop/pkg/utils"
+)
+
+// handleModerations handles the /openai-proxy/v1/moderations endpoint. Requests
+// are passed through to the openai engine, or to the openai_compatible engine
+// named by the model prefix, and the result is returned unchanged.
+func (h *OpenAIProxyHandler) handleModerations(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if isBodyTooLarge(err) {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "body_too_large").Inc()
+		utils.WriteOpenAIError(w, http.StatusRequestEntityTooLarge, utils.ErrTypeInvalidRequest, "request_too_large", "Request body too large")
+		return
+	}
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "read_body_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "", "Error reading request body")
+		return
+	}
+
+	var reqBody struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &reqBody); err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "unmarshal_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "invalid_json", fmt.Sprintf("Error parsing request body: %v", err))
+		return
+	}
+	prefix := "openai"
+	if p, _, found := strings.Cut(reqBody.Model, "/"); found && h.engines.Compatible(p) {
+		prefix = p
+	}
+	if entry := accessLogFromContext(r.Context()); entry != nil {
+		entry.Model = reqBody.Model
+		entry.Engine = prefix
+	}
+
+	proxy, err := h.openAIPassthrough(prefix, reqBody.Model)
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "engine_selection_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusNotFound, utils.ErrTypeInvalidRequest, "model_not_found", fmt.Sprintf("Engine %s is not configured", prefix))
+		return
+	}
+
+	transformedBody, err := proxy.TransformModerationRequest(r.Context(), body)
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "transform_request_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "", fmt.Sprintf("Error transforming request: %v", err))
+		return
+	}
+
+	resp, err := proxy.HandleModerationRequest(r.Context(), transformedBody)
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "handle_request_error").Inc()
+		h.logger.Infof("Error sending moderation request: %v", err)
+		utils.WriteOpenAIError(w, http.StatusBadGateway, utils.ErrTypeAPI, "upstream_error", fmt.Sprintf("Error processing request: %v", err))
+		return
+	}
+
+	if err := proxy.SendChatCompletionResponse(r.Context(), resp, w, false); err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "send_response_error").Inc()
+		h.logger.Errorf("Error sending moderation response: %v", err)
+	}
+}
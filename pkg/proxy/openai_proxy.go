@@ -1,23 +1,53 @@
 package proxy
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/robertprast/goop/pkg/audit"
+	"github.com/robertprast/goop/pkg/engine"
 	"github.com/robertprast/goop/pkg/openai_schema"
 
+	"github.com/robertprast/goop/pkg/engine/azure"
 	"github.com/robertprast/goop/pkg/engine/bedrock"
+	"github.com/robertprast/goop/pkg/engine/mock"
+	"github.com/robertprast/goop/pkg/engine/ollama"
+	"github.com/robertprast/goop/pkg/engine/openai"
+	"github.com/robertprast/goop/pkg/tokenizer"
+	azureproxy "github.com/robertprast/goop/pkg/transformers/azure"
 	bedrockproxy "github.com/robertprast/goop/pkg/transformers/bedrock"
+	mockproxy "github.com/robertprast/goop/pkg/transformers/mock"
+	ollamaproxy "github.com/robertprast/goop/pkg/transformers/ollama"
+	openaiproxy "github.com/robertprast/goop/pkg/transformers/openai"
 	"github.com/robertprast/goop/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
 
+type accessLogCtxKey struct{}
+
+var accessLogKey = accessLogCtxKey{}
+
+// accessLogEntry collects request details that are only known once the
+// handler has parsed the body, for the access log line
+type accessLogEntry struct {
+	Model  string
+	Engine string
+}
+
+func accessLogFromContext(ctx context.Context) *accessLogEntry {
+	entry, _ := ctx.Value(accessLogKey).(*accessLogEntry)
+	return entry
+}
+
 type Response struct {
 	Object string                `json:"object"`
 	Data   []openai_schema.Model `json:"data"`
@@ -26,26 +56,91 @@ type Response struct {
 // OpenAIProxyEngine defines the interface for OpenAI proxy engines
 type OpenAIProxyEngine interface {
 	HandleChatCompletionRequest(ctx context.Context, model string, stream bool, transformedBody []byte) (*http.Response, error)
-	SendChatCompletionResponse(bedrockResp *http.Response, w http.ResponseWriter, stream bool) error
-	TransformChatCompletionRequest(reqBody openai_schema.IncomingChatCompletionRequest) ([]byte, error)
+	SendChatCompletionResponse(ctx context.Context, resp *http.Response, w http.ResponseWriter, stream bool) error
+	TransformChatCompletionRequest(ctx context.Context, reqBody openai_schema.IncomingChatCompletionRequest) ([]byte, error)
 }
 
 // OpenAIProxyHandler holds dependencies for the OpenAI proxy
 type OpenAIProxyHandler struct {
-	config  *utils.Config
-	logger  *logrus.Logger
-	metrics *OpenaiProxyMetrics
+	config       *utils.Config
+	engines      *EngineCache
+	logger       *logrus.Logger
+	accessLogger *logrus.Logger
+	metrics      *OpenaiProxyMetrics
+	userLimiter  *userRateLimiter
+	capture      *streamCaptureSink
+	deadLetters  *deadLetterSink
+	breakers     *circuitBreakers
+	limiter      *engineLimiter
+	tokenizers   *tokenizer.Registry
+	// requestHooks and responseHooks run around the engine's transform and send steps
+	requestHooks  []RequestTransformer
+	responseHooks []ResponseTransformer
+	models        *modelCache
+	streams       *StreamTracker
 }
 
 // NewHandler creates a new OpenAI proxy handler with logging and telemetry
-func NewHandler(config *utils.Config, logger *logrus.Logger, metrics *OpenaiProxyMetrics) http.Handler {
+func NewHandler(config *utils.Config, engines *EngineCache, logger *logrus.Logger, metrics *OpenaiProxyMetrics, streams *StreamTracker) http.Handler {
+	accessLogger := logrus.New()
+	accessLogger.SetOutput(logger.Out)
+	accessLogger.SetFormatter(&logrus.JSONFormatter{})
+
 	handler := &OpenAIProxyHandler{
-		config:  config,
-		logger:  logger,
-		metrics: metrics,
+		config:       config,
+		engines:      engines,
+		logger:       logger,
+		accessLogger: accessLogger,
+		metrics:      metrics,
+		streams:      streams,
+		models:       newModelCache(config.ModelsCacheTTL),
+		tokenizers:   tokenizer.NewRegistry(config.Tokenizer.Encodings),
 	}
+	// Model lists cached from the old engines may be stale once their configs change
+	engines.OnReload(handler.models.invalidate)
+	metrics.EnableMetadataLabels(config.Metrics.MetadataLabels)
+	if config.Auth.RateLimitByUser && config.Auth.UserRequestsPerMinute > 0 {
+		handler.userLimiter = newUserRateLimiter(config.Auth.UserRequestsPerMinute)
+	}
+	if config.Audit.StreamCapturePath != "" {
+		capture, err := newStreamCaptureSink(config.Audit.StreamCapturePath, config.Audit.StreamCaptureBuffer)
+		if err != nil {
+			logger.Errorf("Error opening stream capture file, streams won't be captured: %v", err)
+		} else {
+			handler.capture = capture
+		}
+	}
+	if config.DeadLetter.Enabled {
+		deadLetters, err := newDeadLetterSink(config.DeadLetter.Path)
+		if err != nil {
+			logger.Errorf("Error opening dead letter file, failed requests won't be recorded: %v", err)
+		} else {
+			handler.deadLetters = deadLetters
+		}
+	}
+	if config.CircuitBreaker.Enabled {
+		handler.breakers = newCircuitBreakers(config.CircuitBreaker, func(engine string, state breakerState) {
+			logger.Warnf("Circuit breaker for engine %s is now %s", engine, state)
+			metrics.CircuitBreakerTransitions.WithLabelValues(engine, string(state)).Inc()
+		})
+	}
+	if len(config.Concurrency.MaxConcurrent) > 0 {
+		handler.limiter = newEngineLimiter(config.Concurrency, metrics.EngineQueueDepth)
+	}
+	if config.Request.SystemPromptPrefix != "" || len(config.Request.SystemPromptPrefixByModel) > 0 {
+		handler.requestHooks = append(handler.requestHooks, systemPromptPrefix{
+			prefix:  config.Request.SystemPromptPrefix,
+			byModel: config.Request.SystemPromptPrefixByModel,
+		})
+	}
+	if config.Request.MaxTokensCap > 0 {
+		handler.requestHooks = append(handler.requestHooks, maxTokensCap{limit: config.Request.MaxTokensCap})
+	}
+	handler.requestHooks = append(handler.requestHooks, requestTransformers...)
+	handler.responseHooks = append(handler.responseHooks, responseTransformers...)
+
 	var finalHandler http.Handler = http.HandlerFunc(handler.ServeHTTP)
-	finalHandler = chainMiddlewares(finalHandler, handler.auditMiddleware, handler.loggingMiddleware)
+	finalHandler = chainMiddlewares(finalHandler, receivedAtMiddleware, headerLimitMiddleware(config.Server.MaxHeaderCount), bodyLimitMiddleware(config.Server.MaxRequestBytes), corsMiddleware(config.Server.CORS), handler.accessLogMiddleware, handler.auditMiddleware, handler.loggingMiddleware)
 	return finalHandler
 }
 
@@ -57,15 +152,52 @@ func chainMiddlewares(finalHandler http.Handler, middlewares ...Middleware) http
 	return finalHandler
 }
 
+// accessLogMiddleware assigns each request an ID, returns it in the X-Request-Id
+// header and emits one structured JSON access log line once the request completes
+func (h *OpenAIProxyHandler) accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		requestID := uuid.New().String()
+		w.Header().Set("X-Request-Id", requestID)
+
+		entry := &accessLogEntry{}
+		ctx := context.WithValue(r.Context(), engine.RequestId, requestID)
+		ctx = context.WithValue(ctx, accessLogKey, entry)
+
+		rec := &StatusRecorder{ResponseWriter: w, StatusCode: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		h.accessLogger.WithFields(logrus.Fields{
+			"request_id":  requestID,
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"model":       entry.Model,
+			"engine":      entry.Engine,
+			"status":      rec.StatusCode,
+			"duration_ms": time.Since(startTime).Milliseconds(),
+		}).Info("access")
+	})
+}
+
 // auditMiddleware audits each request and records errors if any
 func (h *OpenAIProxyHandler) auditMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, ok := audit.Sample(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
 		h.logger.Infof("Auditing request: %s %s", r.Method, r.URL.Path)
 		err := audit.Request(r)
+		if isBodyTooLarge(err) {
+			h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "body_too_large").Inc()
+			utils.WriteOpenAIError(w, http.StatusRequestEntityTooLarge, utils.ErrTypeInvalidRequest, "request_too_large", "Request body too large")
+			return
+		}
 		if err != nil {
 			h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "audit_failed").Inc()
 			h.logger.Errorf("Audit failed: %v", err)
-			http.Error(w, "Audit failed", http.StatusInternalServerError)
+			utils.WriteOpenAIError(w, http.StatusInternalServerError, utils.ErrTypeAPI, "", "Audit failed")
 			return
 		}
 		next.ServeHTTP(w, r)
@@ -105,48 +237,111 @@ func (h *OpenAIProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodPost {
 			h.handleChatCompletions(w, r)
 		} else {
-			h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "method_not_allowed").Inc()
-			http.Error(w, "Unsupported method", http.StatusMethodNotAllowed)
+			h.methodNotAllowed(w, r, http.MethodPost)
+		}
+	case "/openai-proxy/v1/images/generations":
+		if r.Method == http.MethodPost {
+			h.handleImageGenerations(w, r)
+		} else {
+			h.methodNotAllowed(w, r, http.MethodPost)
+		}
+	case "/openai-proxy/v1/audio/transcriptions":
+		if r.Method == http.MethodPost {
+			h.handleAudioTranscriptions(w, r)
+		} else {
+			h.methodNotAllowed(w, r, http.MethodPost)
+		}
+	case "/openai-proxy/v1/moderations":
+		if r.Method == http.MethodPost {
+			h.handleModerations(w, r)
+		} else {
+			h.methodNotAllowed(w, r, http.MethodPost)
+		}
+	case "/openai-proxy/v1/responses":
+		if r.Method == http.MethodPost {
+			h.handleResponses(w, r)
+		} else {
+			h.methodNotAllowed(w, r, http.MethodPost)
+		}
+	case "/openai-proxy/v1/rerank":
+		if r.Method == http.MethodPost {
+			h.handleRerank(w, r)
+		} else {
+			h.methodNotAllowed(w, r, http.MethodPost)
+		}
+	case "/openai-proxy/v1/tokenize":
+		if r.Method == http.MethodPost {
+			h.handleTokenize(w, r)
+		} else {
+			h.methodNotAllowed(w, r, http.MethodPost)
+		}
+	case "/openai-proxy/v1/bedrock/invoke":
+		if r.Method == http.MethodPost {
+			h.handleBedrockInvoke(w, r)
+		} else {
+			h.methodNotAllowed(w, r, http.MethodPost)
 		}
 	default:
 		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "unsupported_path").Inc()
-		http.Error(w, "Unsupported path", http.StatusNotFound)
+		utils.WriteOpenAIError(w, http.StatusNotFound, utils.ErrTypeInvalidRequest, "unknown_url",
+			fmt.Sprintf("Unknown request URL: %s %s", r.Method, r.URL.Path))
 	}
 
 	duration := time.Since(startTime).Seconds()
 	h.metrics.RequestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
 }
 
-// handleModels handles the /openai-proxy/v1/models endpoint
+// methodNotAllowed rejects a request to a known path with an unsupported method
+func (h *OpenAIProxyHandler) methodNotAllowed(w http.ResponseWriter, r *http.Request, allowed string) {
+	h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "method_not_allowed").Inc()
+	w.Header().Set("Allow", allowed)
+	utils.WriteOpenAIError(w, http.StatusMethodNotAllowed, utils.ErrTypeInvalidRequest, "method_not_allowed",
+		fmt.Sprintf("Method %s is not supported for %s", r.Method, r.URL.Path))
+}
+
+// handleModels handles the /openai-proxy/v1/models endpoint. Engines are listed
+// concurrently, an engine that fails or is too slow is left out of the list.
+// `?refresh=true` drops the cached lists first, `?input=image` and `?output=embedding`
+// keep only models with that modality.
 func (h *OpenAIProxyHandler) handleModels(w http.ResponseWriter, r *http.Request) {
 	h.logger.Infof("Fetching model list")
-	models := Response{
-		Object: "list",
-		Data:   []openai_schema.Model{}}
 
-	logrus.Infof(h.config.Engines["bedrock"])
-	bedrockEngine, err := bedrock.NewBedrockEngine(h.config.Engines["bedrock"])
-	if err != nil {
-		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "bedrock model list error").Inc()
-		h.logger.Errorf("Error listing bedrock models: %v", err)
-		http.Error(w, "Error listing bedrock models", http.StatusInternalServerError)
+	var names []string
+	for _, name := range []string{"bedrock", "ollama", "mock"} {
+		if _, ok := h.engines.Config(name); ok {
+			names = append(names, name)
+		}
 	}
-	bModels, err := bedrockEngine.ListModels()
-	if err != nil {
-		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "bedrock model list error").Inc()
-		h.logger.Errorf("Error listing bedrock models: %v", err)
-		http.Error(w, "Error listing bedrock models", http.StatusInternalServerError)
+
+	if r.URL.Query().Get("refresh") == "true" {
+		h.logger.Infof("Refreshing cached model lists")
+		h.models.invalidate()
 	}
 
-	logrus.Infof("Got the models from bedrock %v", bModels)
-	models.Data = append(models.Data, bModels...)
+	engineModels, failed := h.listModels(names)
+	for _, name := range failed {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, name+" model list error").Inc()
+	}
+	if len(names) > 0 && len(failed) == len(names) {
+		utils.WriteOpenAIError(w, http.StatusBadGateway, utils.ErrTypeAPI, "", "Error listing models")
+		return
+	}
+
+	query := r.URL.Query()
+	if input, output := query.Get("input"), query.Get("output"); input != "" || output != "" {
+		engineModels = filterModalities(engineModels, input, output)
+	}
 
+	models := Response{
+		Object: "list",
+		Data:   engineModels,
+	}
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(models)
+	err := json.NewEncoder(w).Encode(models)
 	if err != nil {
 		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "encode_error").Inc()
 		h.logger.Errorf("Error encoding models response: %v", err)
-		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		utils.WriteOpenAIError(w, http.StatusInternalServerError, utils.ErrTypeAPI, "", "Error encoding response")
 		return
 	}
 }
@@ -155,10 +350,15 @@ func (h *OpenAIProxyHandler) handleModels(w http.ResponseWriter, r *http.Request
 func (h *OpenAIProxyHandler) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
 	// Read the entire body first
 	body, err := io.ReadAll(r.Body)
+	if isBodyTooLarge(err) {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "body_too_large").Inc()
+		utils.WriteOpenAIError(w, http.StatusRequestEntityTooLarge, utils.ErrTypeInvalidRequest, "request_too_large", "Request body too large")
+		return
+	}
 	if err != nil {
 		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "read_body_error").Inc()
 		h.logger.Errorf("Error reading request body: %v", err)
-		http.Error(w, "Error reading request body", http.StatusInternalServerError)
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "", "Error reading request body")
 		return
 	}
 	defer func(Body io.ReadCloser) {
@@ -176,73 +376,454 @@ func (h *OpenAIProxyHandler) handleChatCompletions(w http.ResponseWriter, r *htt
 	if err := json.Unmarshal(body, &reqBody); err != nil {
 		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "unmarshal_error").Inc()
 		h.logger.Errorf("Error parsing request body: %v", err)
-		http.Error(w, "Error parsing request body", http.StatusBadRequest)
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "invalid_json", fmt.Sprintf("Error parsing request body: %v", err))
 		return
 	}
+	if err := reqBody.ValidateTools(); err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "invalid_tools").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "invalid_tools", err.Error())
+		return
+	}
+
+	if h.config.Request.CollapseSingleTextContent {
+		reqBody.CollapseSingleTextContent()
+	}
 
 	h.logger.Debugf("Request body after transform: %+v", reqBody)
 	h.metrics.ChatCompletions.WithLabelValues(reqBody.Model).Inc()
 
+	if h.userLimiter != nil {
+		user := ""
+		if reqBody.User != nil {
+			user = *reqBody.User
+		}
+		if allowed, retryAfter := h.userLimiter.Allow(rateLimitKey(r, user)); !allowed {
+			h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "rate_limited").Inc()
+			h.logger.Warnf("Rate limit exceeded for user %q", user)
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			utils.WriteOpenAIError(w, http.StatusTooManyRequests, utils.ErrTypeRateLimit, "rate_limit_exceeded", "Rate limit exceeded")
+			return
+		}
+	}
+
+	// HTTP/1.0 has no chunked transfer encoding, so streamed responses
+	// can't be delivered incrementally. Fall back to a buffered response.
+	if reqBody.Stream && !r.ProtoAtLeast(1, 1) {
+		h.logger.Infof("Client uses %s, sending a buffered response instead of streaming", r.Proto)
+		reqBody.Stream = false
+		reqBody.StreamOptions = nil
+	}
+
 	h.handleChatCompletionsInternal(w, r, reqBody, reqBody.Stream)
 }
 
 // handleChatCompletionsInternal processes the chat completions request
 func (h *OpenAIProxyHandler) handleChatCompletionsInternal(w http.ResponseWriter, r *http.Request, reqBody openai_schema.IncomingChatCompletionRequest, stream bool) {
+	startTime := time.Now()
+	rec := &StatusRecorder{ResponseWriter: w, StatusCode: http.StatusOK}
+	w = rec
+	// Until an engine is selected the model is whatever the client sent, so
+	// early errors are labeled unknownModel to keep the series bounded
+	metricsModel := unknownModel
+	defer func() {
+		h.observeChatCompletion(metricsModel, rec.StatusCode, time.Since(startTime))
+	}()
+	timeout, err := h.requestTimeout(r)
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "invalid_timeout").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "invalid_timeout", err.Error())
+		return
+	}
+	ctx := r.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	reqBody.Model = h.routeModel(reqBody)
+	reqBody.Model = h.applyDefaultEngine(reqBody.Model)
+
+	if entry := accessLogFromContext(r.Context()); entry != nil {
+		entry.Model = reqBody.Model
+		entry.Engine, _, _ = strings.Cut(reqBody.Model, "/")
+	}
+
+	if h.config.Request.ValidateModels {
+		if known, suggestions := h.validateModel(reqBody.Model); !known {
+			h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "unknown_model").Inc()
+			message := fmt.Sprintf("Unknown model %q", reqBody.Model)
+			if len(suggestions) > 0 {
+				message += fmt.Sprintf(", did you mean: %s", strings.Join(suggestions, ", "))
+			}
+			utils.WriteOpenAIError(w, http.StatusNotFound, utils.ErrTypeInvalidRequest, "model_not_found", message)
+			return
+		}
+	}
+
 	proxyEngine, err := h.selectEngine(reqBody.Model)
 	if err != nil {
 		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "engine_selection_error").Inc()
 		h.logger.Errorf("Error getting engine: %v", err)
-		http.Error(w, "Error selecting engine", http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, errUnsupportedModel):
+			utils.WriteOpenAIError(w, http.StatusNotFound, utils.ErrTypeInvalidRequest, "model_not_found", err.Error())
+		case errors.Is(err, errEngineNotFound):
+			utils.WriteOpenAIError(w, http.StatusNotFound, utils.ErrTypeInvalidRequest, "model_not_found", fmt.Sprintf("No engine configured for model %q", reqBody.Model))
+		default:
+			utils.WriteOpenAIError(w, http.StatusInternalServerError, utils.ErrTypeAPI, "", "Error selecting engine")
+		}
+		return
+	}
+
+	metricsModel = reqBody.Model
+	h.metrics.ObserveMetadata(metricsModel, reqBody.Metadata)
+
+	// Report what actually serves the request, after routing and the default engine
+	selectedEngine, _, _ := strings.Cut(reqBody.Model, "/")
+	w.Header().Set("X-Goop-Engine", selectedEngine)
+	w.Header().Set("X-Goop-Model", reqBody.Model)
+
+	if stream && !h.supportsStreaming(reqBody.Model) {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "streaming_not_supported").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "streaming_not_supported",
+			fmt.Sprintf("model %s does not support streaming", reqBody.Model))
 		return
 	}
 
-	transformedBody, err := proxyEngine.TransformChatCompletionRequest(reqBody)
+	for _, hook := range h.requestHooks {
+		if err := hook.TransformRequest(ctx, &reqBody); err != nil {
+			h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "request_rejected").Inc()
+			h.logger.Infof("Request for %s rejected by hook: %v", reqBody.Model, err)
+			utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "request_rejected", err.Error())
+			return
+		}
+	}
+
+	transformedBody, err := proxyEngine.TransformChatCompletionRequest(ctx, reqBody)
+	if h.timedOut(ctx) {
+		h.writeTimeout(w, r, reqBody.Model, timeout, "transform")
+		return
+	}
 	if err != nil {
 		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "transform_error").Inc()
 		h.logger.Infof("Error transforming request: %v", err)
-		http.Error(w, "Error transforming request", http.StatusInternalServerError)
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "", fmt.Sprintf("Error transforming request: %v", err))
 		return
 	}
 	h.logger.Debugf("Transformed request: %s", string(transformedBody))
 
-	resp, err := proxyEngine.HandleChatCompletionRequest(r.Context(), reqBody.Model, stream, transformedBody)
+	if stream {
+		var done func()
+		ctx, done = h.streams.Track(ctx)
+		defer done()
+
+		w = &ttftWriter{ResponseWriter: w, start: receivedAt(r.Context()), observer: h.metrics.TTFT.WithLabelValues(reqBody.Model)}
+		if h.capture != nil {
+			requestID, _ := ctx.Value(engine.RequestId).(string)
+			w = &captureWriter{ResponseWriter: w, sink: h.capture, requestID: requestID, model: reqBody.Model}
+		}
+	}
+
+	engineName, _, _ := strings.Cut(reqBody.Model, "/")
+	if h.limiter != nil {
+		release, ok := h.limiter.Acquire(ctx, engineName)
+		if !ok {
+			h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "engine_busy").Inc()
+			w.Header().Set("Retry-After", "1")
+			utils.WriteOpenAIError(w, http.StatusTooManyRequests, utils.ErrTypeRateLimit, "engine_busy",
+				fmt.Sprintf("Too many concurrent requests for engine %s", engineName))
+			return
+		}
+		// Held until the response is sent, streams count as in flight
+		defer release()
+	}
+
+	if h.breakers != nil {
+		if allowed, retryAfter := h.breakers.Allow(engineName); !allowed {
+			h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "circuit_open").Inc()
+			if h.config.DegradedMode.Enabled && h.breakers.AllOpen(h.engines.Names()) {
+				h.logger.Warnf("Circuit open for every engine, serving degraded response for %s", reqBody.Model)
+				if err := h.writeDegradedResponse(w, reqBody.Model, stream); err != nil {
+					h.logger.Errorf("Error writing degraded response: %v", err)
+				}
+				return
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			utils.WriteOpenAIError(w, http.StatusServiceUnavailable, utils.ErrTypeAPI, "circuit_open",
+				fmt.Sprintf("Engine %s is failing, requests are paused", engineName))
+			return
+		}
+	}
+
+	resp, err := proxyEngine.HandleChatCompletionRequest(ctx, reqBody.Model, stream, transformedBody)
+	if h.breakers != nil {
+		if err != nil && ctx.Err() != nil {
+			// The client went away or its deadline passed, which says nothing about the engine
+			h.breakers.Release(engineName)
+		} else {
+			h.breakers.Record(engineName, err == nil && resp.StatusCode < http.StatusInternalServerError)
+		}
+	}
+	h.recordDeadLetter(r, reqBody.Model, transformedBody, resp, err)
+	if h.timedOut(ctx) {
+		h.writeTimeout(w, r, reqBody.Model, timeout, "upstream request")
+		return
+	}
 	if err != nil {
 		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "handle_request_error").Inc()
 		h.logger.Infof("Error processing request: %v", err)
-		http.Error(w, fmt.Sprintf("Error processing request: %v", err), http.StatusInternalServerError)
+		utils.WriteOpenAIError(w, http.StatusBadGateway, utils.ErrTypeAPI, "upstream_error", fmt.Sprintf("Error processing request: %v", err))
 		return
 	}
 
-	if err := proxyEngine.SendChatCompletionResponse(resp, w, stream); err != nil {
+	for _, hook := range h.responseHooks {
+		if err := hook.TransformResponse(ctx, reqBody.Model, resp); err != nil {
+			_ = resp.Body.Close()
+			h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "response_rejected").Inc()
+			h.logger.Errorf("Response for %s rejected by hook: %v", reqBody.Model, err)
+			utils.WriteOpenAIError(w, http.StatusBadGateway, utils.ErrTypeAPI, "upstream_error", fmt.Sprintf("Error processing response: %v", err))
+			return
+		}
+	}
+
+	if err := proxyEngine.SendChatCompletionResponse(ctx, resp, w, stream); err != nil {
+		if r.Context().Err() != nil {
+			h.logger.Infof("Client disconnected, stopped response for %s", reqBody.Model)
+			return
+		}
+		if stream && h.streams.Stopping() {
+			h.logger.Infof("Stream for %s stopped for shutdown", reqBody.Model)
+			h.finishStream(w)
+			return
+		}
+		if h.timedOut(ctx) {
+			h.writeTimeout(w, r, reqBody.Model, timeout, "response")
+			return
+		}
 		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "send_response_error").Inc()
 		h.logger.Infof("Error sending response: %v", err)
-		http.Error(w, fmt.Sprintf("Error sending response: %v", err), http.StatusInternalServerError)
+		utils.WriteOpenAIError(w, http.StatusBadGateway, utils.ErrTypeAPI, "upstream_error", fmt.Sprintf("Error sending response: %v", err))
+		return
+	}
+}
+
+// unknownModel labels chat completion metrics of requests that failed before
+// their model was matched to an engine
+const unknownModel = "unknown"
+
+// observeChatCompletion records a chat completion's duration and, for error
+// statuses, its error by model, engine and status class
+func (h *OpenAIProxyHandler) observeChatCompletion(model string, status int, elapsed time.Duration) {
+	engineName, _, _ := strings.Cut(model, "/")
+	class := statusClass(status)
+	duration := elapsed.Seconds()
+	h.metrics.ChatCompletionDurations.WithLabelValues(model, engineName, class).Observe(duration)
+	if status >= http.StatusBadRequest {
+		h.metrics.ChatCompletionErrors.WithLabelValues(model, engineName, class).Inc()
+	}
+	h.logger.Infof("Chat completion for %s finished with %d in %.4f seconds", model, status, duration)
+}
+
+// timedOut reports whether the request's total timeout has elapsed
+func (h *OpenAIProxyHandler) timedOut(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
+
+// writeTimeout responds with 504 once the total request timeout elapsed during stage
+func (h *OpenAIProxyHandler) writeTimeout(w http.ResponseWriter, r *http.Request, model string, timeout time.Duration, stage string) {
+	h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "request_timeout").Inc()
+	h.logger.Warnf("Request for %s timed out after %s during %s", model, timeout, stage)
+	utils.WriteOpenAIError(w, http.StatusGatewayTimeout, utils.ErrTypeAPI, "timeout", "Request timed out")
+}
+
+// supportsStreaming reports whether model can stream, from the Bedrock model
+// list. Models the list doesn't cover, and other engines, are assumed to stream.
+func (h *OpenAIProxyHandler) supportsStreaming(model string) bool {
+	if !strings.HasPrefix(model, "bedrock/") {
+		return true
+	}
+	eng, err := h.engines.Get("bedrock")
+	if err != nil {
+		return true
+	}
+	models, err := h.models.get("bedrock", eng)
+	if err != nil {
+		h.logger.Warnf("Skipping streaming check, error listing bedrock models: %v", err)
+		return true
+	}
+	for _, m := range models {
+		if modelMatches(m.ID, model) && m.StreamingSupported != nil {
+			return *m.StreamingSupported
+		}
+	}
+	return true
+}
+
+// validateModel checks model against its engine's cached model list and returns
+// close matches when it isn't listed. Models are assumed valid when the engine
+// can't be resolved or doesn't list its models.
+func (h *OpenAIProxyHandler) validateModel(model string) (bool, []string) {
+	name, _, _ := strings.Cut(model, "/")
+	eng, err := h.engines.Get(name)
+	if err != nil {
+		return true, nil
+	}
+	models, err := h.models.get(name, eng)
+	if err != nil {
+		h.logger.Warnf("Skipping model validation, error listing %s models: %v", name, err)
+		return true, nil
+	}
+	if len(models) == 0 {
+		return true, nil
+	}
+	for _, m := range models {
+		if modelMatches(m.ID, model) {
+			return true, nil
+		}
+	}
+	return false, suggestModels(model, models)
+}
+
+// recordDeadLetter writes the upstream request to the dead letter sink when it
+// failed with an error or a 5xx status
+func (h *OpenAIProxyHandler) recordDeadLetter(r *http.Request, model string, body []byte, resp *http.Response, upstreamErr error) {
+	if h.deadLetters == nil {
+		return
+	}
+	if upstreamErr == nil && resp.StatusCode < http.StatusInternalServerError {
+		return
+	}
+
+	entry := deadLetterEntry{
+		Time:    time.Now(),
+		Model:   model,
+		Headers: r.Header,
+		Body:    body,
+	}
+	entry.RequestID, _ = r.Context().Value(engine.RequestId).(string)
+	entry.Engine, _, _ = strings.Cut(model, "/")
+	if upstreamErr != nil {
+		entry.Error = upstreamErr.Error()
+	} else {
+		entry.Status = resp.StatusCode
+		if resp.Request != nil {
+			entry.Target = resp.Request.URL.Redacted()
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			h.logger.Errorf("Error reading failed upstream response: %v", err)
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(respBody))
+		entry.Error = string(respBody)
+	}
+
+	if err := h.deadLetters.record(entry); err != nil {
+		h.logger.Errorf("Error writing dead letter entry: %v", err)
+	}
+}
+
+// finishStream terminates an SSE stream with a final [DONE] so clients don't see a truncated stream
+func (h *OpenAIProxyHandler) finishStream(w http.ResponseWriter) {
+	if _, err := w.Write([]byte("data: [DONE]\n\n")); err != nil {
+		h.logger.Errorf("Error finishing stream: %v", err)
 		return
 	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
 
-	duration := time.Since(time.Now()).Seconds()
-	h.metrics.ChatCompletionDurations.WithLabelValues(reqBody.Model).Observe(duration)
+// applyDefaultEngine prefixes model with request.default_engine when it
+// doesn't already name an engine
+func (h *OpenAIProxyHandler) applyDefaultEngine(model string) string {
+	defaultEngine := h.config.Request.DefaultEngine
+	if defaultEngine == "" {
+		return model
+	}
+	prefix, _, found := strings.Cut(model, "/")
+	if found && h.isEngine(prefix) {
+		return model
+	}
+	h.logger.Debugf("Routing model %s to default engine %s", model, defaultEngine)
+	return defaultEngine + "/" + model
+}
+
+// chatEngines maps every engine prefix to the constructor of its chat completion
+// proxy. Engines that don't serve chat completions map to nil, so their prefix is
+// still recognized as an engine. `openai_compatible` backends use the passthrough too.
+var chatEngines = map[string]func(prefix string, eng engine.Engine) OpenAIProxyEngine{
+	"openai": newOpenAIPassthrough,
+	"bedrock": func(_ string, eng engine.Engine) OpenAIProxyEngine {
+		return &bedrockproxy.BedrockProxy{BedrockEngine: eng.(*bedrock.BedrockEngine)}
+	},
+	"ollama": func(_ string, eng engine.Engine) OpenAIProxyEngine {
+		return ollamaproxy.NewOllamaProxy(eng.(*ollama.OllamaEngine))
+	},
+	"mock": func(_ string, eng engine.Engine) OpenAIProxyEngine {
+		return mockproxy.NewMockProxy(eng.(*mock.MockEngine))
+	},
+	"azure": func(_ string, eng engine.Engine) OpenAIProxyEngine {
+		return azureproxy.NewAzureProxy(eng.(*azure.AzureOpenAIEngine))
+	},
+	"vertex": nil,
+	"cohere": nil,
+}
+
+// isEngine reports whether prefix names an engine, so the model isn't given the default engine's prefix
+func (h *OpenAIProxyHandler) isEngine(prefix string) bool {
+	if _, ok := chatEngines[prefix]; ok {
+		return true
+	}
+	return h.engines.Compatible(prefix)
 }
 
 // selectEngine selects the appropriate engine based on the model and records errors
 func (h *OpenAIProxyHandler) selectEngine(model string) (OpenAIProxyEngine, error) {
-	switch {
-	case strings.HasPrefix(model, "bedrock/"):
-		h.logger.Info("Selecting Bedrock engine")
-		bedrockEngine, err := bedrock.NewBedrockEngine(h.config.Engines["bedrock"])
-		if err != nil {
-			h.metrics.ErrorsTotal.WithLabelValues("bedrock", model, "engine_init_error").Inc()
-			h.logger.Errorf("Error creating Bedrock engine: %v", err)
-			return nil, err
-		}
-		return &bedrockproxy.BedrockProxy{
-			BedrockEngine: bedrockEngine,
-		}, nil
-	case strings.HasPrefix(model, "vertex/"):
-		h.metrics.ErrorsTotal.WithLabelValues("vertex", model, "not_implemented").Inc()
-		return nil, fmt.Errorf("vertex AI not yet implemented")
-	default:
+	prefix, _, found := strings.Cut(model, "/")
+	newProxy, known := chatEngines[prefix]
+	if !known && h.engines.Compatible(prefix) {
+		newProxy, known = newOpenAIPassthrough, true
+	}
+	if !found || !known {
 		h.metrics.ErrorsTotal.WithLabelValues("unknown", model, "unsupported_model").Inc()
-		return nil, fmt.Errorf("unsupported model: %s", model)
+		return nil, fmt.Errorf("%w: %s", errUnsupportedModel, model)
+	}
+	if newProxy == nil {
+		h.metrics.ErrorsTotal.WithLabelValues(prefix, model, "unsupported_model").Inc()
+		return nil, fmt.Errorf("%w: the %s engine doesn't support chat completions", errUnsupportedModel, prefix)
+	}
+
+	h.logger.Infof("Selecting %s engine", prefix)
+	eng, err := h.engines.Get(prefix)
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(prefix, model, "engine_init_error").Inc()
+		h.logger.Errorf("Error creating %s engine: %v", prefix, err)
+		return nil, err
 	}
+	return newProxy(prefix, eng), nil
+}
+
+// openAIPassthrough creates the passthrough for the openai or an openai_compatible
+// engine, sending to the next of its backends
+func (h *OpenAIProxyHandler) openAIPassthrough(prefix, model string) (*openaiproxy.OpenAIProxy, error) {
+	eng, err := h.engines.Get(prefix)
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(prefix, model, "engine_init_error").Inc()
+		h.logger.Errorf("Error creating %s engine: %v", prefix, err)
+		return nil, err
+	}
+	return newOpenAIPassthrough(prefix, eng).(*openaiproxy.OpenAIProxy), nil
+}
+
+// newOpenAIPassthrough creates the passthrough for eng, an openai or openai_compatible
+// engine, sending to the next of its backends
+func newOpenAIPassthrough(prefix string, eng engine.Engine) OpenAIProxyEngine {
+	backend := eng.(*openai.OpenAIEngine).SelectBackend()
+	passthrough := openaiproxy.NewOpenAIProxy(prefix, prefix+"/", backend.ChatCompletionsURL(), backend.APIKey)
+	passthrough.StreamIdleTimeout = backend.StreamIdleTimeout
+	passthrough.StreamFlushBytes = backend.StreamFlushBytes
+	passthrough.StreamFlushInterval = backend.StreamFlushInterval
+	passthrough.Transport = backend.Transport()
+	return passthrough
 }
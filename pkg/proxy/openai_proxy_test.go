@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	mockproxy "github.com/robertprast/goop/pkg/transformers/mock"
+	"github.com/robertprast/goop/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestProxyHandler builds the unwrapped handler, for tests of its methods
+func newTestProxyHandler(config *utils.Config, configs map[string]string) *OpenAIProxyHandler {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return &OpenAIProxyHandler{
+		config:  config,
+		engines: NewEngineCache(configs),
+		logger:  logger,
+		metrics: newOpenaiProxyMetrics(prometheus.NewRegistry()),
+		models:  newModelCache(0),
+	}
+}
+
+func TestSelectEngine(t *testing.T) {
+	h := newTestProxyHandler(&utils.Config{}, map[string]string{"mock": "enabled: true"})
+
+	proxyEngine, err := h.selectEngine("mock/echo")
+	if err != nil {
+		t.Fatalf("selectEngine(mock/echo) error = %v", err)
+	}
+	if _, ok := proxyEngine.(*mockproxy.MockProxy); !ok {
+		t.Errorf("selectEngine(mock/echo) = %T, want *mock.MockProxy", proxyEngine)
+	}
+
+	for _, model := range []string{"cohere/command-r", "vertex/gemini-1.5-pro", "unknown/model", "mock"} {
+		if _, err := h.selectEngine(model); !errors.Is(err, errUnsupportedModel) {
+			t.Errorf("selectEngine(%s) error = %v, want errUnsupportedModel", model, err)
+		}
+	}
+}
+
+func TestApplyDefaultEngine(t *testing.T) {
+	config := &utils.Config{}
+	config.Request.DefaultEngine = "openai"
+	h := newTestProxyHandler(config, nil)
+
+	tests := map[string]string{
+		"gpt-4o":              "openai/gpt-4o",
+		"cohere/command-r":    "cohere/command-r",
+		"bedrock/titan":       "bedrock/titan",
+		"ft:gpt-4o/org/model": "openai/ft:gpt-4o/org/model",
+	}
+	for model, want := range tests {
+		if got := h.applyDefaultEngine(model); got != want {
+			t.Errorf("applyDefaultEngine(%s) = %s, want %s", model, got, want)
+		}
+	}
+}
+
+func TestChatCompletionMetricsLabelUnselectedModelsUnknown(t *testing.T) {
+	config := &utils.Config{}
+	config.Request.ValidateModels = true
+	h := newTestProxyHandler(config, map[string]string{"mock": "enabled: true"})
+
+	for _, model := range []string{"nope/model-1", "nope/model-2", "mock/ech0", "mock/echo"} {
+		postChat(t, h, chatBody(model))
+	}
+
+	want := `
+# HELP openai_proxy_chat_completion_errors_total Total number of chat completion requests answered with an error status by model, engine and status class
+# TYPE openai_proxy_chat_completion_errors_total counter
+openai_proxy_chat_completion_errors_total{engine="unknown",model="unknown",status_class="4xx"} 3
+`
+	if err := testutil.CollectAndCompare(h.metrics.ChatCompletionErrors, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+	// The mock/echo success is the only other duration series
+	if got := testutil.CollectAndCount(h.metrics.ChatCompletionDurations); got != 2 {
+		t.Errorf("duration series = %d, want 2", got)
+	}
+}
@@ -1,9 +1,7 @@
 package proxy
 
 import (
-	"github.com/robertprast/goop/pkg/engine/azure"
-	"github.com/robertprast/goop/pkg/engine/openai"
-	"github.com/robertprast/goop/pkg/engine/vertex"
+	"errors"
 	"net/http"
 	"net/http/httputil"
 	"strings"
@@ -11,7 +9,6 @@ import (
 
 	"github.com/robertprast/goop/pkg/audit"
 	"github.com/robertprast/goop/pkg/engine"
-	"github.com/robertprast/goop/pkg/engine/bedrock"
 	"github.com/robertprast/goop/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
@@ -19,19 +16,21 @@ import (
 // ProxyHandler holds dependencies for the proxy
 type ProxyHandler struct {
 	Config  *utils.Config
+	Engines *EngineCache
 	Logger  *logrus.Logger
 	Metrics *Metrics
 }
 
 // NewProxyHandler creates a new proxy handler with logging and telemetry
-func NewProxyHandler(config *utils.Config, logger *logrus.Logger, metrics *Metrics) http.Handler {
+func NewProxyHandler(config *utils.Config, engines *EngineCache, logger *logrus.Logger, metrics *Metrics) http.Handler {
 	handler := &ProxyHandler{
 		Config:  config,
+		Engines: engines,
 		Logger:  logger,
 		Metrics: metrics,
 	}
 	var finalHandler http.Handler = http.HandlerFunc(handler.reverseProxy)
-	finalHandler = chainMiddlewares(finalHandler, handler.auditMiddleware, handler.engineMiddleware, handler.loggingMiddleware)
+	finalHandler = chainMiddlewares(finalHandler, headerLimitMiddleware(config.Server.MaxHeaderCount), bodyLimitMiddleware(config.Server.MaxRequestBytes), corsMiddleware(config.Server.CORS), handler.auditMiddleware, handler.engineMiddleware, handler.loggingMiddleware)
 	return finalHandler
 }
 
@@ -54,8 +53,18 @@ func (h *ProxyHandler) loggingMiddleware(next http.Handler) http.Handler {
 // auditMiddleware audits each request and records errors if any
 func (h *ProxyHandler) auditMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, ok := audit.Sample(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
 		h.Logger.Infof("Auditing request: %s %s", r.Method, r.URL.Path)
 		err := audit.Request(r)
+		if isBodyTooLarge(err) {
+			h.Metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "body_too_large").Inc()
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
 		if err != nil {
 			h.Metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "audit_failed").Inc()
 			h.Logger.Errorf("Audit failed: %v", err)
@@ -78,31 +87,12 @@ func (h *ProxyHandler) engineMiddleware(next http.Handler) http.Handler {
 		firstPathSegment := segments[1]
 		h.Logger.Infof("First path segment: %s", firstPathSegment)
 
-		// Check if config has engine
-		engineConfig, ok := h.Config.Engines[firstPathSegment]
-		if !ok {
-			h.Metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "engine_not_found").Inc()
-			http.Error(w, "Engine not found", http.StatusNotFound)
-			return
-		}
-
-		var eng engine.Engine
-		var err error
-		switch firstPathSegment {
-		case "openai":
-			eng, err = openai.NewOpenAIEngineWithConfig(engineConfig)
-		case "azure":
-			eng, err = azure.NewAzureOpenAIEngineWithConfig(engineConfig)
-		case "bedrock":
-			eng, err = bedrock.NewBedrockEngine(engineConfig)
-		case "vertex":
-			eng, err = vertex.NewVertexEngine(engineConfig)
-		default:
+		eng, err := h.Engines.Get(firstPathSegment)
+		if errors.Is(err, errEngineNotFound) {
 			h.Metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "engine_not_found").Inc()
 			http.Error(w, "Engine not found", http.StatusNotFound)
 			return
 		}
-
 		if err != nil {
 			h.Metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "engine_init_failed").Inc()
 			h.Logger.Errorf("Error selecting engine: %v", err)
@@ -133,10 +123,26 @@ func (h *ProxyHandler) reverseProxy(w http.ResponseWriter, r *http.Request) {
 
 	eng.ModifyRequest(r)
 
+	// Engines with custom TLS settings provide their own transport
+	var transport http.RoundTripper = http.DefaultTransport
+	if t, ok := eng.(interface{ Transport() http.RoundTripper }); ok {
+		transport = t.Transport()
+	}
+
 	proxy := &httputil.ReverseProxy{
 		Director:       func(req *http.Request) {},
 		ModifyResponse: audit.Response,
-		Transport:      http.DefaultTransport,
+		Transport:      transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if isBodyTooLarge(err) {
+				h.Metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "body_too_large").Inc()
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			h.Metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "upstream_error").Inc()
+			h.Logger.Errorf("Proxy error: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
 	}
 
 	flusher, ok := w.(http.Flusher)
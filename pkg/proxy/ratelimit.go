@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// userRateLimiter counts requests per caller key and end user in fixed one
+// minute windows, so a key shared by many end users stays fair across them
+type userRateLimiter struct {
+	mu          sync.Mutex
+	limit       int
+	window      time.Duration
+	windowStart time.Time
+	counts      map[string]int
+}
+
+func newUserRateLimiter(requestsPerMinute int) *userRateLimiter {
+	return &userRateLimiter{
+		limit:  requestsPerMinute,
+		window: time.Minute,
+		counts: make(map[string]int),
+	}
+}
+
+// Allow records a request for key and reports whether it is within the limit.
+// When it isn't, the time until the window resets is returned.
+func (l *userRateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.windowStart) >= l.window {
+		l.windowStart = now
+		l.counts = make(map[string]int)
+	}
+	if l.counts[key] >= l.limit {
+		return false, l.window - now.Sub(l.windowStart)
+	}
+	l.counts[key]++
+	return true, 0
+}
+
+// rateLimitKey combines the caller's credential with the request's `user`.
+// The credential is hashed so API keys aren't kept in memory.
+func rateLimitKey(r *http.Request, user string) string {
+	credential := r.Header.Get("Authorization")
+	if credential == "" {
+		credential = r.Header.Get("Api-Key")
+	}
+	sum := sha256.Sum256([]byte(credential))
+	return hex.EncodeToString(sum[:8]) + "|" + user
+}
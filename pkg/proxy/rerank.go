@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/robertprast/goop/pkg/openai_schema"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/robertprast/goop/pkg/engine/bedrock"
+	"github.com/robertprast/goop/pkg/engine/cohere"
+	bedrockproxy "github.com/robertprast/goop/pkg/transformers/bedrock"
+	cohereproxy "github.com/robertprast/goop/pkg/transformers/cohere"
+	"github.com/robertprast/goop/pkg/utils"
+)
+
+// RerankEngine is implemented by engines that serve /v1/rerank
+type RerankEngine interface {
+	TransformRerankRequest(ctx context.Context, reqBody openai_schema.RerankRequest) ([]byte, error)
+	HandleRerankRequest(ctx context.Context, model string, transformedBody []byte) (*http.Response, error)
+	SendRerankResponse(ctx context.Context, resp *http.Response, w http.ResponseWriter) error
+}
+
+// handleRerank handles the /openai-proxy/v1/rerank endpoint
+func (h *OpenAIProxyHandler) handleRerank(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if isBodyTooLarge(err) {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "body_too_large").Inc()
+		utils.WriteOpenAIError(w, http.StatusRequestEntityTooLarge, utils.ErrTypeInvalidRequest, "request_too_large", "Request body too large")
+		return
+	}
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "read_body_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "", "Error reading request body")
+		return
+	}
+
+	var reqBody openai_schema.RerankRequest
+	if err := json.Unmarshal(body, &reqBody); err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "unmarshal_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "invalid_json", fmt.Sprintf("Error parsing request body: %v", err))
+		return
+	}
+	if reqBody.Model == "" || reqBody.Query == "" || len(reqBody.Documents) == 0 {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "invalid_request").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "", "'model', 'query' and 'documents' are required")
+		return
+	}
+	reqBody.Model = h.applyDefaultEngine(reqBody.Model)
+	if entry := accessLogFromContext(r.Context()); entry != nil {
+		entry.Model = reqBody.Model
+		entry.Engine, _, _ = strings.Cut(reqBody.Model, "/")
+	}
+
+	proxy, err := h.selectRerankEngine(reqBody.Model)
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "engine_selection_error").Inc()
+		if errors.Is(err, errUnsupportedModel) || errors.Is(err, errEngineNotFound) {
+			utils.WriteOpenAIError(w, http.StatusNotFound, utils.ErrTypeInvalidRequest, "model_not_found", err.Error())
+		} else {
+			utils.WriteOpenAIError(w, http.StatusInternalServerError, utils.ErrTypeAPI, "", fmt.Sprintf("Error selecting engine: %v", err))
+		}
+		return
+	}
+
+	transformedBody, err := proxy.TransformRerankRequest(r.Context(), reqBody)
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "transform_request_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "", fmt.Sprintf("Error transforming request: %v", err))
+		return
+	}
+
+	resp, err := proxy.HandleRerankRequest(r.Context(), reqBody.Model, transformedBody)
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "handle_request_error").Inc()
+		h.logger.Infof("Error reranking with %s: %v", reqBody.Model, err)
+		utils.WriteOpenAIError(w, http.StatusBadGateway, utils.ErrTypeAPI, "upstream_error", fmt.Sprintf("Error processing request: %v", err))
+		return
+	}
+
+	if err := proxy.SendRerankResponse(r.Context(), resp, w); err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "send_response_error").Inc()
+		h.logger.Errorf("Error sending rerank response: %v", err)
+	}
+}
+
+// selectRerankEngine returns the rerank engine for model
+func (h *OpenAIProxyHandler) selectRerankEngine(model string) (RerankEngine, error) {
+	prefix, _, _ := strings.Cut(model, "/")
+	switch prefix {
+	case "bedrock":
+		eng, err := h.engines.Get("bedrock")
+		if err != nil {
+			h.logger.Errorf("Error creating Bedrock engine: %v", err)
+			return nil, err
+		}
+		return &bedrockproxy.BedrockProxy{BedrockEngine: eng.(*bedrock.BedrockEngine)}, nil
+	case "cohere":
+		eng, err := h.engines.Get("cohere")
+		if err != nil {
+			h.logger.Errorf("Error creating Cohere engine: %v", err)
+			return nil, err
+		}
+		return &cohereproxy.CohereProxy{CohereEngine: eng.(*cohere.CohereEngine)}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s does not support rerank", errUnsupportedModel, model)
+	}
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/robertprast/goop/pkg/utils"
+)
+
+// handleResponses handles the /openai-proxy/v1/responses endpoint. OpenAI's
+// Responses API is passed through to the openai engine, or to the
+// openai_compatible engine named by the model prefix. Other engines only
+// serve chat completions and are rejected.
+func (h *OpenAIProxyHandler) handleResponses(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if isBodyTooLarge(err) {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "body_too_large").Inc()
+		utils.WriteOpenAIError(w, http.StatusRequestEntityTooLarge, utils.ErrTypeInvalidRequest, "request_too_large", "Request body too large")
+		return
+	}
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "read_body_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "", "Error reading request body")
+		return
+	}
+
+	var reqBody struct {
+		Model  string `json:"model"`
+		Stream bool   `json:"stream"`
+	}
+	if err := json.Unmarshal(body, &reqBody); err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "unmarshal_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "invalid_json", fmt.Sprintf("Error parsing request body: %v", err))
+		return
+	}
+	if reqBody.Model == "" {
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "", "'model' is required")
+		return
+	}
+
+	model := h.applyDefaultEngine(reqBody.Model)
+	prefix, _, found := strings.Cut(model, "/")
+	switch {
+	case found && (prefix == "openai" || h.engines.Compatible(prefix)):
+	case found && h.isEngine(prefix):
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "unsupported_model").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "unsupported_model",
+			fmt.Sprintf("The Responses API is not supported for %s models, use /openai-proxy/v1/chat/completions instead", prefix))
+		return
+	default:
+		// Unprefixed models are OpenAI models
+		prefix = "openai"
+	}
+	if entry := accessLogFromContext(r.Context()); entry != nil {
+		entry.Model = model
+		entry.Engine = prefix
+	}
+
+	proxy, err := h.openAIPassthrough(prefix, model)
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "engine_selection_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusNotFound, utils.ErrTypeInvalidRequest, "model_not_found", fmt.Sprintf("Engine %s is not configured", prefix))
+		return
+	}
+
+	transformedBody, err := proxy.TransformResponsesRequest(r.Context(), body, model)
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "transform_request_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "", fmt.Sprintf("Error transforming request: %v", err))
+		return
+	}
+
+	resp, err := proxy.HandleResponsesRequest(r.Context(), transformedBody)
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "handle_request_error").Inc()
+		h.logger.Infof("Error sending responses request: %v", err)
+		utils.WriteOpenAIError(w, http.StatusBadGateway, utils.ErrTypeAPI, "upstream_error", fmt.Sprintf("Error processing request: %v", err))
+		return
+	}
+
+	if err := proxy.SendChatCompletionResponse(r.Context(), resp, w, reqBody.Stream); err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "send_response_error").Inc()
+		h.logger.Errorf("Error sending responses response: %v", err)
+	}
+}
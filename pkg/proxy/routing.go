@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"github.com/robertprast/goop/pkg/openai_schema"
+	"github.com/robertprast/goop/pkg/utils"
+)
+
+// messageOverheadTokens approximates the role and separator tokens each message adds
+const messageOverheadTokens = 4
+
+// routeModel applies the routing rules to the request and returns the model
+// to use, the requested one when no rule matches
+func (h *OpenAIProxyHandler) routeModel(reqBody openai_schema.IncomingChatCompletionRequest) string {
+	rules := h.config.Routing.Rules
+	if len(rules) == 0 {
+		return reqBody.Model
+	}
+
+	tokens := -1
+	for _, rule := range rules {
+		if rule.Model != reqBody.Model {
+			continue
+		}
+		if rule.MaxPromptTokens > 0 {
+			if tokens < 0 {
+				tokens = estimatePromptTokens(reqBody.Messages)
+			}
+			if tokens > rule.MaxPromptTokens {
+				continue
+			}
+		}
+		h.logger.Debugf("Routing %s to %s, estimated prompt tokens: %d", reqBody.Model, rule.Target, tokens)
+		return rule.Target
+	}
+	return reqBody.Model
+}
+
+// estimatePromptTokens estimates the prompt size of messages from their text
+func estimatePromptTokens(messages []openai_schema.ChatMessage) int {
+	tokens := 0
+	for _, msg := range messages {
+		tokens += messageOverheadTokens
+		if msg.Content != nil {
+			tokens += utils.EstimateTokens(*msg.Content)
+		}
+		for _, part := range msg.ContentParts {
+			tokens += utils.EstimateTokens(part.Text)
+		}
+		for _, call := range msg.ToolCalls {
+			tokens += utils.EstimateTokens(call.Function.Name) + utils.EstimateTokens(call.Function.Arguments)
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxClientTimeout caps X-Goop-Timeout when server.request_timeout is unset
+const maxClientTimeout = 10 * time.Minute
+
+// requestTimeout returns the timeout for a chat completion: the client's
+// X-Goop-Timeout header (in seconds) when sent, otherwise server.request_timeout.
+// Zero means unlimited.
+func (h *OpenAIProxyHandler) requestTimeout(r *http.Request) (time.Duration, error) {
+	header := r.Header.Get("X-Goop-Timeout")
+	if header == "" {
+		return h.config.Server.RequestTimeout, nil
+	}
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) || seconds <= 0 {
+		return 0, fmt.Errorf("X-Goop-Timeout must be a positive number of seconds, got %q", header)
+	}
+	limit := h.config.Server.RequestTimeout
+	if limit <= 0 {
+		limit = maxClientTimeout
+	}
+	// Compared as seconds, converting a huge value to a Duration would overflow
+	if seconds > limit.Seconds() {
+		return 0, fmt.Errorf("X-Goop-Timeout must not exceed %s", limit)
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout <= 0 {
+		return 0, fmt.Errorf("X-Goop-Timeout must be a positive number of seconds, got %q", header)
+	}
+	return timeout, nil
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/robertprast/goop/pkg/utils"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	tests := []struct {
+		name          string
+		header        string
+		serverTimeout time.Duration
+		want          time.Duration
+		wantErr       bool
+	}{
+		{name: "no header uses server timeout", serverTimeout: 30 * time.Second, want: 30 * time.Second},
+		{name: "no header and no server timeout", want: 0},
+		{name: "fractional seconds", header: "0.5", serverTimeout: time.Minute, want: 500 * time.Millisecond},
+		{name: "within default cap", header: "60", want: time.Minute},
+		{name: "over server timeout", header: "31", serverTimeout: 30 * time.Second, wantErr: true},
+		{name: "over default cap", header: "601", wantErr: true},
+		{name: "zero", header: "0", wantErr: true},
+		{name: "negative", header: "-1", wantErr: true},
+		{name: "not a number", header: "abc", wantErr: true},
+		{name: "NaN", header: "NaN", serverTimeout: 30 * time.Second, wantErr: true},
+		{name: "Inf", header: "Inf", serverTimeout: 30 * time.Second, wantErr: true},
+		{name: "overflowing duration", header: "1e300", serverTimeout: 30 * time.Second, wantErr: true},
+		{name: "tiny value rounding to zero", header: "1e-300", serverTimeout: 30 * time.Second, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &OpenAIProxyHandler{config: &utils.Config{Server: utils.ServerConfig{RequestTimeout: tt.serverTimeout}}}
+			r := httptest.NewRequest("POST", "/openai-proxy/v1/chat/completions", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Goop-Timeout", tt.header)
+			}
+			got, err := h.requestTimeout(r)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("requestTimeout() = %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("requestTimeout() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("requestTimeout() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
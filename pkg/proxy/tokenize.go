@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/robertprast/goop/pkg/openai_schema"
+	"io"
+	"net/http"
+
+	"github.com/robertprast/goop/pkg/tokenizer"
+	"github.com/robertprast/goop/pkg/utils"
+)
+
+// tokenizeResponse is the body of /openai-proxy/v1/tokenize
+type tokenizeResponse struct {
+	Model        string `json:"model"`
+	PromptTokens int    `json:"prompt_tokens"`
+	// Tokenizer is the encoding used, "estimate" when the count is a heuristic
+	Tokenizer string `json:"tokenizer"`
+}
+
+// handleTokenize handles the /openai-proxy/v1/tokenize endpoint. It takes a
+// chat completion request and returns its prompt token count without sending it.
+func (h *OpenAIProxyHandler) handleTokenize(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if isBodyTooLarge(err) {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "body_too_large").Inc()
+		utils.WriteOpenAIError(w, http.StatusRequestEntityTooLarge, utils.ErrTypeInvalidRequest, "request_too_large", "Request body too large")
+		return
+	}
+	if err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "read_body_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "", "Error reading request body")
+		return
+	}
+
+	var reqBody openai_schema.IncomingChatCompletionRequest
+	if err := json.Unmarshal(body, &reqBody); err != nil {
+		h.metrics.ErrorsTotal.WithLabelValues(r.Method, r.URL.Path, "unmarshal_error").Inc()
+		utils.WriteOpenAIError(w, http.StatusBadRequest, utils.ErrTypeInvalidRequest, "invalid_json", fmt.Sprintf("Error parsing request body: %v", err))
+		return
+	}
+
+	tok := h.tokenizers.ForModel(reqBody.Model)
+	resp := tokenizeResponse{
+		Model:        reqBody.Model,
+		PromptTokens: tokenizer.CountMessages(tok, reqBody.Messages),
+		Tokenizer:    tok.Name(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.logger.Errorf("Error encoding tokenize response: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type receivedAtCtxKey struct{}
+
+// receivedAtMiddleware records when the request was received, before any
+// other middleware reads headers or the body
+func receivedAtMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), receivedAtCtxKey{}, time.Now())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// receivedAt returns when the request was received, or now when
+// receivedAtMiddleware didn't run
+func receivedAt(ctx context.Context) time.Time {
+	if t, ok := ctx.Value(receivedAtCtxKey{}).(time.Time); ok {
+		return t
+	}
+	return time.Now()
+}
+
+// ttftWriter observes the time from request receipt to the first streamed
+// chunk written to the client. Error responses are not observed.
+type ttftWriter struct {
+	http.ResponseWriter
+	start    time.Time
+	observer prometheus.Observer
+
+	once   sync.Once
+	failed bool
+}
+
+func (t *ttftWriter) WriteHeader(code int) {
+	if code != http.StatusOK {
+		t.failed = true
+	}
+	t.ResponseWriter.WriteHeader(code)
+}
+
+func (t *ttftWriter) Write(b []byte) (int, error) {
+	n, err := t.ResponseWriter.Write(b)
+	if n > 0 && !t.failed {
+		t.once.Do(func() { t.observer.Observe(time.Since(t.start).Seconds()) })
+	}
+	return n, err
+}
+
+func (t *ttftWriter) Flush() {
+	if flusher, ok := t.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type recordingObserver struct {
+	values []float64
+}
+
+func (o *recordingObserver) Observe(v float64) {
+	o.values = append(o.values, v)
+}
+
+func TestTTFTIncludesTimeBeforeHandler(t *testing.T) {
+	const delay = 30 * time.Millisecond
+	observer := &recordingObserver{}
+	handler := receivedAtMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Stands in for the body read, parsing and validation before streaming starts
+		time.Sleep(delay)
+		w = &ttftWriter{ResponseWriter: w, start: receivedAt(r.Context()), observer: observer}
+		_, _ = w.Write([]byte("data: {}\n\n"))
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/openai-proxy/v1/chat/completions", nil))
+
+	if len(observer.values) != 1 {
+		t.Fatalf("observed %d values, want 1", len(observer.values))
+	}
+	if got := time.Duration(observer.values[0] * float64(time.Second)); got < delay {
+		t.Errorf("ttft = %s, want at least %s since receipt", got, delay)
+	}
+}
+
+func TestTTFTSkipsErrorResponses(t *testing.T) {
+	observer := &recordingObserver{}
+	w := &ttftWriter{ResponseWriter: httptest.NewRecorder(), start: time.Now(), observer: observer}
+	w.WriteHeader(http.StatusBadGateway)
+	_, _ = w.Write([]byte(`{"error":{}}`))
+
+	if len(observer.values) != 0 {
+		t.Errorf("observed %v for an error response, want nothing", observer.values)
+	}
+}
+
+func TestReceivedAtWithoutMiddleware(t *testing.T) {
+	before := time.Now()
+	if got := receivedAt(httptest.NewRequest(http.MethodGet, "/", nil).Context()); got.Before(before) {
+		t.Errorf("receivedAt = %s, want now without the middleware", got)
+	}
+}
@@ -0,0 +1,142 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Pre-tokenizer patterns of the tiktoken encodings. RE2 has no lookahead, so
+// tiktoken's `\s+(?!\S)` alternative is emulated in split.
+var patterns = map[string]*regexp.Regexp{
+	"cl100k_base": regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`),
+	"o200k_base": regexp.MustCompile(`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|` +
+		`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|` +
+		`\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+`),
+}
+
+// bpe counts tokens with a tiktoken byte pair encoding
+type bpe struct {
+	name    string
+	ranks   map[string]int
+	pattern *regexp.Regexp
+}
+
+// loadBPE reads a tiktoken rank file, one "<base64 token> <rank>" per line
+func loadBPE(name, path string) (*bpe, error) {
+	pattern, ok := patterns[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding %s", name)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		token, rank, found := bytes.Cut(line, []byte(" "))
+		if !found {
+			return nil, fmt.Errorf("invalid line in %s: %q", path, line)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(string(token))
+		if err != nil {
+			return nil, fmt.Errorf("invalid token in %s: %w", path, err)
+		}
+		r, err := strconv.Atoi(string(rank))
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank in %s: %w", path, err)
+		}
+		ranks[string(decoded)] = r
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &bpe{name: name, ranks: ranks, pattern: pattern}, nil
+}
+
+func (b *bpe) Name() string { return b.name }
+
+// Count returns the number of tokens text encodes to
+func (b *bpe) Count(text string) int {
+	count := 0
+	for _, piece := range b.split(text) {
+		if _, ok := b.ranks[piece]; ok {
+			count++
+			continue
+		}
+		count += b.merge(piece)
+	}
+	return count
+}
+
+// split pre-tokenizes text. A whitespace run followed by a non-space keeps its
+// last character for the next piece, as `\s+(?!\S)` does in tiktoken.
+func (b *bpe) split(text string) []string {
+	var pieces []string
+	for len(text) > 0 {
+		loc := b.pattern.FindStringIndex(text)
+		if loc == nil {
+			break
+		}
+		end := loc[1]
+		match := text[loc[0]:end]
+		if end < len(text) && isSpaces(match) && utf8.RuneCountInString(match) > 1 {
+			next, _ := utf8.DecodeRuneInString(text[end:])
+			if !unicode.IsSpace(next) {
+				_, size := utf8.DecodeLastRuneInString(match)
+				end -= size
+			}
+		}
+		pieces = append(pieces, text[loc[0]:end])
+		text = text[end:]
+	}
+	return pieces
+}
+
+// isSpaces reports whether s is a whitespace run without line breaks, the
+// only kind of match the `\s+` alternatives produce
+func isSpaces(s string) bool {
+	for _, r := range s {
+		if !unicode.IsSpace(r) || r == '\r' || r == '\n' {
+			return false
+		}
+	}
+	return true
+}
+
+// merge applies byte pair merges to piece, always merging the lowest ranked
+// pair first, and returns the number of parts left
+func (b *bpe) merge(piece string) int {
+	parts := make([]string, len(piece))
+	for i := 0; i < len(piece); i++ {
+		parts[i] = piece[i : i+1]
+	}
+	for len(parts) > 1 {
+		best, bestRank := -1, 0
+		for i := 0; i < len(parts)-1; i++ {
+			rank, ok := b.ranks[parts[i]+parts[i+1]]
+			if ok && (best < 0 || rank < bestRank) {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return len(parts)
+}
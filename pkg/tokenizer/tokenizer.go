@@ -0,0 +1,114 @@
+package tokenizer
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/robertprast/goop/pkg/openai_schema"
+	"github.com/robertprast/goop/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// Tokenizer counts the tokens of a text
+type Tokenizer interface {
+	// Name is the encoding name, e.g. "cl100k_base", or "estimate" for the heuristic
+	Name() string
+	Count(text string) int
+}
+
+// Chat format overhead of OpenAI models: every message is wrapped in role and
+// separator tokens, and the reply is primed with a few more
+const (
+	tokensPerMessage = 3
+	tokensPerName    = 1
+	tokensPerReply   = 3
+)
+
+// estimator is the fallback when no encoding is available for a model
+type estimator struct{}
+
+func (estimator) Name() string { return "estimate" }
+
+func (estimator) Count(text string) int { return utils.EstimateTokens(text) }
+
+// Registry picks a tokenizer per model. BPE encodings are loaded from their
+// tiktoken rank files on first use, other models use the estimator.
+type Registry struct {
+	files map[string]string
+
+	mu     sync.Mutex
+	loaded map[string]Tokenizer
+}
+
+// NewRegistry creates a registry for the tiktoken rank files keyed by encoding name
+func NewRegistry(files map[string]string) *Registry {
+	return &Registry{
+		files:  files,
+		loaded: make(map[string]Tokenizer),
+	}
+}
+
+// ForModel returns the tokenizer for model, the engine prefix is ignored
+func (r *Registry) ForModel(model string) Tokenizer {
+	if _, name, found := strings.Cut(model, "/"); found {
+		model = name
+	}
+	encoding := encodingForModel(model)
+	if encoding == "" {
+		return estimator{}
+	}
+	path, ok := r.files[encoding]
+	if !ok {
+		return estimator{}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if tok, ok := r.loaded[encoding]; ok {
+		return tok
+	}
+	var tok Tokenizer = estimator{}
+	if encoder, err := loadBPE(encoding, path); err != nil {
+		logrus.Errorf("Error loading %s encoding, falling back to estimates: %v", encoding, err)
+	} else {
+		tok = encoder
+	}
+	r.loaded[encoding] = tok
+	return tok
+}
+
+// encodingForModel returns the tiktoken encoding of an OpenAI model, empty for other models
+func encodingForModel(model string) string {
+	switch {
+	case strings.HasPrefix(model, "gpt-4o"), strings.HasPrefix(model, "gpt-4.1"),
+		strings.HasPrefix(model, "o1"), strings.HasPrefix(model, "o3"), strings.HasPrefix(model, "o4"):
+		return "o200k_base"
+	case strings.HasPrefix(model, "gpt-4"), strings.HasPrefix(model, "gpt-3.5"),
+		strings.HasPrefix(model, "text-embedding-"):
+		return "cl100k_base"
+	default:
+		return ""
+	}
+}
+
+// CountMessages counts the prompt tokens of a chat request's messages,
+// including the chat format overhead
+func CountMessages(tok Tokenizer, messages []openai_schema.ChatMessage) int {
+	tokens := tokensPerReply
+	for _, msg := range messages {
+		tokens += tokensPerMessage + tok.Count(msg.Role)
+		if msg.Content != nil {
+			tokens += tok.Count(*msg.Content)
+		}
+		for _, part := range msg.ContentParts {
+			tokens += tok.Count(part.Text)
+		}
+		if msg.Name != nil {
+			tokens += tokensPerName + tok.Count(*msg.Name)
+		}
+		for _, call := range msg.ToolCalls {
+			tokens += tok.Count(call.Function.Name) + tok.Count(call.Function.Arguments)
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,95 @@
+package tokenizer
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/robertprast/goop/pkg/openai_schema"
+)
+
+// testdata/ranks.tiktoken holds every single byte plus a few merges, among
+// them "hello", " world", "Hello", "123" and "'m"
+const fixtureRanks = "testdata/ranks.tiktoken"
+
+func TestBPEGoldenCounts(t *testing.T) {
+	tests := []struct {
+		text      string
+		cl100k    int
+		o200k     int
+		rationale string
+	}{
+		{"", 0, 0, "nothing to encode"},
+		{"hello", 1, 1, "a ranked piece is one token"},
+		{"hello world", 2, 2, "the leading space joins the word"},
+		{"hello  world", 3, 3, "the last space of a run joins the next word"},
+		{"HelloWorld", 5, 3, "o200k splits at the case change, cl100k merges H e llo Wor ld"},
+		{"12345", 3, 3, "digits are split in runs of three"},
+		{"I'm", 2, 2, "the contraction is ranked"},
+		{"héllo", 4, 4, "é stays two unmerged bytes, h and llo"},
+	}
+
+	cl100k, err := loadBPE("cl100k_base", fixtureRanks)
+	if err != nil {
+		t.Fatalf("loadBPE(cl100k_base) error = %v", err)
+	}
+	o200k, err := loadBPE("o200k_base", fixtureRanks)
+	if err != nil {
+		t.Fatalf("loadBPE(o200k_base) error = %v", err)
+	}
+	for _, tt := range tests {
+		if got := cl100k.Count(tt.text); got != tt.cl100k {
+			t.Errorf("cl100k_base Count(%q) = %d, want %d (%s)", tt.text, got, tt.cl100k, tt.rationale)
+		}
+		if got := o200k.Count(tt.text); got != tt.o200k {
+			t.Errorf("o200k_base Count(%q) = %d, want %d (%s)", tt.text, got, tt.o200k, tt.rationale)
+		}
+	}
+}
+
+func TestLoadBPEErrors(t *testing.T) {
+	if _, err := loadBPE("p50k_base", fixtureRanks); err == nil {
+		t.Error("loadBPE with an unknown encoding succeeded")
+	}
+	if _, err := loadBPE("cl100k_base", filepath.Join(t.TempDir(), "missing.tiktoken")); err == nil {
+		t.Error("loadBPE with a missing file succeeded")
+	}
+}
+
+func TestRegistryForModel(t *testing.T) {
+	registry := NewRegistry(map[string]string{
+		"o200k_base":  fixtureRanks,
+		"cl100k_base": filepath.Join(t.TempDir(), "missing.tiktoken"),
+	})
+
+	tests := map[string]string{
+		"openai/gpt-4o":            "o200k_base",
+		"o3-mini":                  "o200k_base",
+		"openai/gpt-4-turbo":       "estimate", // cl100k_base fails to load
+		"text-embedding-3-small":   "estimate",
+		"bedrock/anthropic.claude": "estimate", // not an OpenAI model
+		"ollama/llama3":            "estimate",
+	}
+	for model, want := range tests {
+		if got := registry.ForModel(model).Name(); got != want {
+			t.Errorf("ForModel(%s) = %s, want %s", model, got, want)
+		}
+	}
+
+	if got := NewRegistry(nil).ForModel("gpt-4o").Name(); got != "estimate" {
+		t.Errorf("ForModel without rank files = %s, want estimate", got)
+	}
+}
+
+func TestCountMessagesWithEstimator(t *testing.T) {
+	content := "Hello there!" // 12 characters, 3 estimated tokens
+	name := "bob"             // 1 estimated token
+	messages := []openai_schema.ChatMessage{
+		{Role: "system", Content: &content}, // role is 2 tokens
+		{Role: "user", Content: &content, Name: &name},
+	}
+	// reply priming + 2 messages * (overhead + role + content) + name overhead + name
+	want := tokensPerReply + (tokensPerMessage + 2 + 3) + (tokensPerMessage + 1 + 3) + tokensPerName + 1
+	if got := CountMessages(estimator{}, messages); got != want {
+		t.Errorf("CountMessages = %d, want %d", got, want)
+	}
+}
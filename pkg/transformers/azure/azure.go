@@ -0,0 +1,73 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"github.com/robertprast/goop/pkg/openai_schema"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/robertprast/goop/pkg/engine/azure"
+	"github.com/robertprast/goop/pkg/transformers/openai"
+)
+
+// AzureProxy serves chat completions through an Azure OpenAI deployment. The
+// request and response are passed through as is, only the URL and
+// credentials of the selected backend are filled in.
+type AzureProxy struct {
+	*azure.AzureOpenAIEngine
+	*openai.OpenAIProxy
+}
+
+// NewAzureProxy creates the chat completions proxy for an Azure engine
+func NewAzureProxy(e *azure.AzureOpenAIEngine) *AzureProxy {
+	return &AzureProxy{
+		AzureOpenAIEngine: e,
+		OpenAIProxy:       openai.NewOpenAIProxy("azure", "azure/", "", ""),
+	}
+}
+
+// TransformChatCompletionRequest rejects models that don't name a deployment
+// before passing the request through
+func (e *AzureProxy) TransformChatCompletionRequest(ctx context.Context, reqBody openai_schema.IncomingChatCompletionRequest) ([]byte, error) {
+	if _, err := deploymentName(reqBody.Model); err != nil {
+		return nil, err
+	}
+	return e.OpenAIProxy.TransformChatCompletionRequest(ctx, reqBody)
+}
+
+// HandleChatCompletionRequest sends the request to the least loaded active
+// backend, with the deployment taken from the model name. The backend counts
+// the request as an open connection until ctx ends, after the response was sent.
+func (e *AzureProxy) HandleChatCompletionRequest(ctx context.Context, model string, stream bool, transformedBody []byte) (*http.Response, error) {
+	backend, err := e.SelectBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	// The passthrough also sends the response, so it carries the backend's stream settings
+	passthrough := openai.NewOpenAIProxy("azure", "azure/", backend.ChatCompletionsURL(model), backend.APIKey)
+	passthrough.StreamIdleTimeout = backend.StreamIdleTimeout
+	passthrough.StreamFlushBytes = backend.StreamFlushBytes
+	passthrough.StreamFlushInterval = backend.StreamFlushInterval
+	passthrough.Transport = backend.Transport()
+	e.OpenAIProxy = passthrough
+
+	atomic.AddInt64(&backend.Connections, 1)
+	context.AfterFunc(ctx, func() { atomic.AddInt64(&backend.Connections, -1) })
+	return passthrough.HandleChatCompletionRequest(ctx, model, stream, transformedBody)
+}
+
+// deploymentName extracts the deployment from a model like "azure/my-deployment".
+// Azure deployment names are a single path segment.
+func deploymentName(model string) (string, error) {
+	name, found := strings.CutPrefix(model, "azure/")
+	if !found {
+		return "", fmt.Errorf("error parsing model: %s", model)
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("invalid azure deployment name %q in model %s", name, model)
+	}
+	return name, nil
+}
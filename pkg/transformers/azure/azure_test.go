@@ -0,0 +1,68 @@
+package azure
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/robertprast/goop/pkg/engine/azure"
+)
+
+func TestHandleChatCompletionRequestConfiguresBackend(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/my-deployment/chat/completions" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	eng, err := azure.NewAzureOpenAIEngineWithConfig(`
+- base_url: ` + upstream.URL + `
+  api_key: test
+  api_version: "2024-04-01-preview"
+  stream_idle_timeout: 5s
+  stream_flush_bytes: 4096
+  stream_flush_interval: 50ms
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close()
+	backend, err := eng.SelectBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := NewAzureProxy(eng)
+	ctx, cancel := context.WithCancel(context.Background())
+	resp, err := proxy.HandleChatCompletionRequest(ctx, "azure/my-deployment", false, []byte(`{}`))
+	if err != nil {
+		t.Fatalf("HandleChatCompletionRequest() error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	if proxy.StreamIdleTimeout != 5*time.Second || proxy.StreamFlushBytes != 4096 || proxy.StreamFlushInterval != 50*time.Millisecond {
+		t.Errorf("stream settings = %s, %d, %s", proxy.StreamIdleTimeout, proxy.StreamFlushBytes, proxy.StreamFlushInterval)
+	}
+	if proxy.Transport == nil {
+		t.Error("transport was not set from the backend")
+	}
+
+	// The request counts as a connection until its context ends
+	if got := atomic.LoadInt64(&backend.Connections); got != 1 {
+		t.Errorf("connections while in flight = %d, want 1", got)
+	}
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&backend.Connections) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := atomic.LoadInt64(&backend.Connections); got != 0 {
+		t.Errorf("connections after the request = %d, want 0", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/robertprast/goop/pkg/openai_schema"
 	"io"
@@ -12,36 +13,104 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
 	"github.com/robertprast/goop/pkg/engine/bedrock"
+	"github.com/robertprast/goop/pkg/utils"
 	"github.com/sirupsen/logrus"
 )
 
 type BedrockProxy struct {
 	*bedrock.BedrockEngine
+
+	// includeUsage is set from the request's stream_options
+	includeUsage bool
+	// model is the requested model, reported back in responses
+	model string
 }
 
-func (e *BedrockProxy) SendChatCompletionResponse(bedrockResp *http.Response, w http.ResponseWriter, stream bool) error {
-	if bedrockResp.Header.Get("Content-Type") == "application/vnd.amazon.eventstream" {
-		return e.handleStreamingResponse(bedrockResp, w)
+// SendChatCompletionResponse picks the response handler from the request's
+// stream flag. Bedrock errors arrive as plain JSON even for converse-stream,
+// so they are relayed before any streaming starts.
+func (e *BedrockProxy) SendChatCompletionResponse(ctx context.Context, bedrockResp *http.Response, w http.ResponseWriter, stream bool) error {
+	utils.CopyRateLimitHeaders(w.Header(), bedrockResp.Header)
+	if bedrockResp.StatusCode != http.StatusOK {
+		return e.handleErrorResponse(bedrockResp, w)
+	}
+	if !stream {
+		return e.handleResponse(bedrockResp, w)
 	}
-	return e.handleResponse(bedrockResp, w)
-}
 
-func (e *BedrockProxy) TransformChatCompletionRequest(reqBody openai_schema.IncomingChatCompletionRequest) ([]byte, error) {
-	var systemMessage []bedrock.SystemMessage
-	messages := transformMessages(reqBody.Messages)
-	if messages == nil {
-		return nil, nil
+	contentType := bedrockResp.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "application/vnd.amazon.eventstream") {
+		_ = bedrockResp.Body.Close()
+		return fmt.Errorf("expected an event stream from Bedrock, got content type %q", contentType)
 	}
-	if messages[0].Role == "system" {
-		systemMessage = []bedrock.SystemMessage{
-			{Text: messages[0].Content[0].Text},
-		}
-		messages = messages[1:]
+
+	bedrockResp.Body = utils.NewIdleTimeoutReader(bedrockResp.Body, e.StreamIdleTimeout)
+	// Stop reading from Bedrock as soon as the client goes away
+	stop := context.AfterFunc(ctx, func() { _ = bedrockResp.Body.Close() })
+	defer stop()
+
+	state := newStreamState(e.model, e.includeUsage)
+	setStreamHeaders(w, state.completion.id)
+
+	var err error
+	if e.StreamCoalesceWindow > 0 {
+		err = e.handleCoalescedStreamingResponse(ctx, bedrockResp, w, state)
 	} else {
-		systemMessage = []bedrock.SystemMessage{
-			{Text: "You are an assistant."},
+		err = e.handleStreamingResponse(ctx, bedrockResp, w, state)
+	}
+	if errors.Is(err, utils.ErrIdleTimeout) {
+		logrus.Warnf("Bedrock stream idle for %s, aborting", e.StreamIdleTimeout)
+		return utils.WriteStreamError(w, "timeout", fmt.Sprintf("upstream stream idle for %s", e.StreamIdleTimeout))
+	}
+	return err
+}
+
+// handleErrorResponse relays a Bedrock error to the client as an OpenAI style
+// error with the upstream status
+func (e *BedrockProxy) handleErrorResponse(bedrockResp *http.Response, w http.ResponseWriter) error {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
 		}
+	}(bedrockResp.Body)
+
+	body, err := io.ReadAll(bedrockResp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading Bedrock error response: %w", err)
 	}
+	var bedrockErr struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &bedrockErr); err != nil || bedrockErr.Message == "" {
+		bedrockErr.Message = strings.TrimSpace(string(body))
+	}
+	logrus.Errorf("Bedrock returned %s: %s", bedrockResp.Status, bedrockErr.Message)
+
+	utils.WriteOpenAIError(w, bedrockResp.StatusCode, utils.ErrTypeAPI, "upstream_error", bedrockErr.Message)
+	return nil
+}
+
+func (e *BedrockProxy) TransformChatCompletionRequest(ctx context.Context, reqBody openai_schema.IncomingChatCompletionRequest) ([]byte, error) {
+	e.model = reqBody.Model
+	// The Converse API returns a single completion, n is normalized to 1 when omitted
+	if reqBody.N != nil && *reqBody.N > 1 {
+		return nil, fmt.Errorf("'n' must be 1 for Bedrock models, multiple completions are not supported")
+	}
+	systemMessage, conversation := splitSystemMessages(reqBody.Messages)
+	messages, err := transformMessages(ctx, conversation, e.HTTPSOnlyImages)
+	if err != nil {
+		return nil, err
+	}
+	if reqBody.StreamOptions != nil {
+		e.includeUsage = reqBody.StreamOptions.IncludeUsage
+		for _, key := range reqBody.StreamOptions.Unrecognized {
+			logrus.Infof("Ignoring unsupported stream_options.%s for Bedrock", key)
+		}
+	}
+
+	logUnsupportedParams(reqBody)
+
 	bedrockRequest := bedrock.Request{
 		Messages:        messages,
 		InferenceConfig: buildInferenceConfig(reqBody),
@@ -56,6 +125,28 @@ func (e *BedrockProxy) TransformChatCompletionRequest(reqBody openai_schema.Inco
 	return json.Marshal(bedrockRequest)
 }
 
+// logUnsupportedParams reports OpenAI parameters Bedrock has no equivalent for.
+// They are dropped from the converse request.
+func logUnsupportedParams(reqBody openai_schema.IncomingChatCompletionRequest) {
+	if len(reqBody.LogitBias) > 0 {
+		logrus.Debug("Dropping logit_bias, not supported by Bedrock")
+	}
+	if reqBody.Logprobs != nil {
+		logrus.Debug("Dropping logprobs, not supported by Bedrock")
+	}
+	if reqBody.TopLogprobs != nil {
+		logrus.Debug("Dropping top_logprobs, not supported by Bedrock")
+	}
+	for _, tool := range reqBody.Tools {
+		if tool.Function.Strict != nil && *tool.Function.Strict {
+			logrus.Debugf("Dropping strict from tool %s, not supported by Bedrock", tool.Function.Name)
+		}
+	}
+	if reqBody.ParallelToolCalls != nil && !*reqBody.ParallelToolCalls {
+		logrus.Warn("Ignoring parallel_tool_calls: false, the Bedrock Converse API can't disable parallel tool use")
+	}
+}
+
 func (e *BedrockProxy) handleResponse(bedrockResp *http.Response, w http.ResponseWriter) error {
 	logrus.Infof("Sending non-streaming response back")
 	logrus.Infof("Bedrock response status: %s", bedrockResp.Status)
@@ -72,11 +163,11 @@ func (e *BedrockProxy) handleResponse(bedrockResp *http.Response, w http.Respons
 		logrus.Infof("Error decoding Bedrock response: %v", err)
 		return err
 	}
-	openAIResp := createOpenAIResponse(bedrockBody)
+	openAIResp := createOpenAIResponse(newCompletion(e.model), bedrockBody)
 	return sendOpenAIResponse(openAIResp, w)
 }
 
-func (e *BedrockProxy) handleStreamingResponse(bedrockResp *http.Response, w http.ResponseWriter) error {
+func (e *BedrockProxy) handleStreamingResponse(ctx context.Context, bedrockResp *http.Response, w http.ResponseWriter, state *streamState) error {
 	logrus.Info("Sending streaming response back")
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
@@ -89,6 +180,9 @@ func (e *BedrockProxy) handleStreamingResponse(bedrockResp *http.Response, w htt
 	var payloadBuf []byte
 
 	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		event, err := decoder.Decode(bedrockResp.Body, payloadBuf)
 		if err == io.EOF {
 			break
@@ -99,24 +193,35 @@ func (e *BedrockProxy) handleStreamingResponse(bedrockResp *http.Response, w htt
 		logrus.Infof("Received streaming event event: %v", event)
 		logrus.Debugf("Event payload: %s", string(event.Payload))
 
-		if err := processStreamingEvent(event, w); err != nil {
+		if err := processStreamingEvent(event, w, state); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return sendDone(w)
 }
 
 func (e *BedrockProxy) HandleChatCompletionRequest(ctx context.Context, model string, stream bool, transformedBody []byte) (*http.Response, error) {
+	return e.post(ctx, model, getEndpointSuffix(stream), transformedBody)
+}
+
+// HandleInvokeRequest sends a model-native body to InvokeModel, for models
+// the converse API doesn't cover such as Titan embeddings and image models
+func (e *BedrockProxy) HandleInvokeRequest(ctx context.Context, model string, body []byte) (*http.Response, error) {
+	return e.post(ctx, model, "invoke", body)
+}
+
+// post signs and sends body to the model's endpoint with the given suffix
+func (e *BedrockProxy) post(ctx context.Context, model, suffix string, body []byte) (*http.Response, error) {
 	model, found := strings.CutPrefix(model, "bedrock/")
 	if !found {
 		return nil, fmt.Errorf("error parsing model: %s", model)
 	}
 
-	endpoint := fmt.Sprintf("%s/model/%s/%s", e.Backend.String(), model, getEndpointSuffix(stream))
+	endpoint := fmt.Sprintf("%s/model/%s/%s", e.Backend.String(), model, suffix)
 	logrus.Infof("Bedrock endpoint: %s", endpoint)
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(transformedBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
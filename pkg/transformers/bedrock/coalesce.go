@@ -0,0 +1,126 @@
+package bedrock
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+	"github.com/robertprast/goop/pkg/engine/bedrock"
+	"github.com/sirupsen/logrus"
+)
+
+type decodeResult struct {
+	event eventstream.Message
+	err   error
+}
+
+// chunkCoalescer buffers streamed text deltas so they can be written to the
+// client as a single merged chunk.
+type chunkCoalescer struct {
+	w       http.ResponseWriter
+	state   *streamState
+	pending strings.Builder
+}
+
+func (c *chunkCoalescer) add(content string) {
+	c.pending.WriteString(content)
+}
+
+// flush writes any buffered text as one chunk.
+func (c *chunkCoalescer) flush() error {
+	if c.pending.Len() == 0 {
+		return nil
+	}
+	content := c.pending.String()
+	c.pending.Reset()
+	return sendOpenAIChunk(createOpenAIChunk(c.state.completion, content, nil), c.w)
+}
+
+// handleCoalescedStreamingResponse streams the Bedrock response like
+// handleStreamingResponse, but merges text deltas arriving within
+// StreamCoalesceWindow. Buffered text is never held longer than one window.
+func (e *BedrockProxy) handleCoalescedStreamingResponse(ctx context.Context, bedrockResp *http.Response, w http.ResponseWriter, state *streamState) error {
+	logrus.Infof("Sending streaming response back with a %s coalescing window", e.StreamCoalesceWindow)
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(bedrockResp.Body)
+
+	// The decoder blocks on the upstream body, so it runs in its own
+	// goroutine to let the ticker flush buffered text in the meantime.
+	events := make(chan decodeResult)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		decoder := eventstream.NewDecoder()
+		for {
+			event, err := decoder.Decode(bedrockResp.Body, nil)
+			select {
+			case events <- decodeResult{event: event, err: err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(e.StreamCoalesceWindow)
+	defer ticker.Stop()
+
+	coalescer := &chunkCoalescer{w: w, state: state}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := coalescer.flush(); err != nil {
+				return err
+			}
+		case res := <-events:
+			if res.err == io.EOF {
+				if err := coalescer.flush(); err != nil {
+					return err
+				}
+				return sendDone(w)
+			} else if res.err != nil {
+				return res.err
+			}
+			logrus.Debugf("Event payload: %s", string(res.event.Payload))
+
+			if content, ok := textDelta(res.event); ok {
+				coalescer.add(content)
+				continue
+			}
+			if err := coalescer.flush(); err != nil {
+				return err
+			}
+			if err := processStreamingEvent(res.event, w, state); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// textDelta returns the text of a contentBlockDelta event, if it carries plain text.
+func textDelta(event eventstream.Message) (string, bool) {
+	if getEventType(event.Headers) != "contentBlockDelta" {
+		return "", false
+	}
+	var payload bedrock.CustomContentBlockDeltaEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return "", false
+	}
+	var delta bedrock.ContentBlockDelta
+	if err := json.Unmarshal(payload.Delta, &delta); err != nil || delta.Text == nil || *delta.Text == "" {
+		return "", false
+	}
+	return *delta.Text, true
+}
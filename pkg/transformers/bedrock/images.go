@@ -0,0 +1,128 @@
+package bedrock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/robertprast/goop/pkg/openai_schema"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robertprast/goop/pkg/utils"
+)
+
+// titanImageRequest is the InvokeModel body shared by Titan Image Generator and Nova Canvas
+type titanImageRequest struct {
+	TaskType              string               `json:"taskType"`
+	TextToImageParams     titanTextToImage     `json:"textToImageParams"`
+	ImageGenerationConfig titanImageGeneration `json:"imageGenerationConfig"`
+}
+
+type titanTextToImage struct {
+	Text string `json:"text"`
+}
+
+type titanImageGeneration struct {
+	NumberOfImages int    `json:"numberOfImages"`
+	Width          int    `json:"width,omitempty"`
+	Height         int    `json:"height,omitempty"`
+	Quality        string `json:"quality,omitempty"`
+}
+
+type titanImageResponse struct {
+	Images []string `json:"images"`
+	Error  *string  `json:"error"`
+}
+
+// isImageModel reports whether model takes the Titan text to image request
+func isImageModel(model string) bool {
+	return strings.Contains(model, "titan-image") || strings.Contains(model, "nova-canvas")
+}
+
+// TransformImageGenerationRequest converts an OpenAI image generation request
+// to the Titan/Nova Canvas InvokeModel body
+func (e *BedrockProxy) TransformImageGenerationRequest(ctx context.Context, body []byte, reqBody openai_schema.ImageGenerationRequest) ([]byte, error) {
+	if !isImageModel(reqBody.Model) {
+		return nil, fmt.Errorf("model %s does not support image generation, only Titan Image Generator and Nova Canvas models do", reqBody.Model)
+	}
+	if reqBody.ResponseFormat == "url" {
+		return nil, errors.New("bedrock only returns images as b64_json")
+	}
+
+	config := titanImageGeneration{NumberOfImages: 1, Quality: "standard"}
+	if reqBody.N != nil {
+		if *reqBody.N < 1 {
+			return nil, fmt.Errorf("'n' must be at least 1, got %d", *reqBody.N)
+		}
+		config.NumberOfImages = *reqBody.N
+	}
+	if reqBody.Quality == "hd" {
+		config.Quality = "premium"
+	}
+	if reqBody.Size != "" {
+		width, height, err := parseImageSize(reqBody.Size)
+		if err != nil {
+			return nil, err
+		}
+		config.Width, config.Height = width, height
+	}
+
+	return json.Marshal(titanImageRequest{
+		TaskType:              "TEXT_IMAGE",
+		TextToImageParams:     titanTextToImage{Text: reqBody.Prompt},
+		ImageGenerationConfig: config,
+	})
+}
+
+// parseImageSize parses an OpenAI "WxH" size
+func parseImageSize(size string) (int, int, error) {
+	w, h, found := strings.Cut(size, "x")
+	width, wErr := strconv.Atoi(w)
+	height, hErr := strconv.Atoi(h)
+	if !found || wErr != nil || hErr != nil {
+		return 0, 0, fmt.Errorf("invalid size %q, expected WIDTHxHEIGHT", size)
+	}
+	return width, height, nil
+}
+
+// HandleImageGenerationRequest sends the image request to InvokeModel
+func (e *BedrockProxy) HandleImageGenerationRequest(ctx context.Context, model string, transformedBody []byte) (*http.Response, error) {
+	return e.post(ctx, model, "invoke", transformedBody)
+}
+
+// SendImageGenerationResponse converts the Titan response to OpenAI's images response
+func (e *BedrockProxy) SendImageGenerationResponse(ctx context.Context, bedrockResp *http.Response, w http.ResponseWriter) error {
+	if bedrockResp.StatusCode != http.StatusOK {
+		return e.handleErrorResponse(bedrockResp, w)
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(bedrockResp.Body)
+
+	var titanResp titanImageResponse
+	if err := json.NewDecoder(bedrockResp.Body).Decode(&titanResp); err != nil {
+		return fmt.Errorf("error decoding Bedrock image response: %w", err)
+	}
+	if titanResp.Error != nil && *titanResp.Error != "" {
+		utils.WriteOpenAIError(w, http.StatusBadGateway, utils.ErrTypeAPI, "upstream_error", *titanResp.Error)
+		return nil
+	}
+
+	resp := openai_schema.ImageGenerationResponse{
+		Created: time.Now().Unix(),
+		Data:    make([]openai_schema.ImageData, 0, len(titanResp.Images)),
+	}
+	for _, image := range titanResp.Images {
+		resp.Data = append(resp.Data, openai_schema.ImageData{B64JSON: image})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(resp)
+}
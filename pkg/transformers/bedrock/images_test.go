@@ -0,0 +1,50 @@
+package bedrock
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/robertprast/goop/pkg/openai_schema"
+)
+
+func TestTransformImageGenerationRequestN(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       *int
+		want    int
+		wantErr bool
+	}{
+		{name: "omitted", want: 1},
+		{name: "three", n: intPtr(3), want: 3},
+		{name: "zero", n: intPtr(0), wantErr: true},
+		{name: "negative", n: intPtr(-2), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := &BedrockProxy{}
+			reqBody := openai_schema.ImageGenerationRequest{Model: "bedrock/amazon.titan-image-generator-v2:0", Prompt: "a cat", N: tt.n}
+			body, err := proxy.TransformImageGenerationRequest(context.Background(), nil, reqBody)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("TransformImageGenerationRequest() = %s, want an error", body)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("TransformImageGenerationRequest() error = %v", err)
+			}
+			var req titanImageRequest
+			if err := json.Unmarshal(body, &req); err != nil {
+				t.Fatal(err)
+			}
+			if req.ImageGenerationConfig.NumberOfImages != tt.want {
+				t.Errorf("numberOfImages = %d, want %d", req.ImageGenerationConfig.NumberOfImages, tt.want)
+			}
+		})
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
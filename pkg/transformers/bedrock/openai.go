@@ -2,38 +2,49 @@ package bedrock
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/robertprast/goop/pkg/engine/bedrock"
 	"github.com/sirupsen/logrus"
 	"net/http"
 	"time"
 )
 
-func createOpenAIChunk(content string, toolCall *bedrock.ToolCall) map[string]interface{} {
+// completion identifies one chat completion. Every chunk of a stream carries
+// the same ID, creation time and model.
+type completion struct {
+	id      string
+	created int64
+	// model is echoed back as requested, e.g. "bedrock/anthropic.claude-3-haiku-20240307-v1:0"
+	model string
+}
+
+func newCompletion(model string) completion {
+	return completion{
+		id:      "chatcmpl-" + uuid.New().String(),
+		created: time.Now().Unix(),
+		model:   model,
+	}
+}
+
+// createOpenAIChunk builds a chunk whose delta carries content, a tool call
+// fragment, or both
+func createOpenAIChunk(c completion, content string, toolCall map[string]interface{}) map[string]interface{} {
 
 	delta := map[string]interface{}{}
 	if content != "" {
 		delta["content"] = content
 	}
 	if toolCall != nil {
-		delta["tool_calls"] = []map[string]interface{}{
-			{
-				"index": 0,
-				"id":    toolCall.ID,
-				"type":  toolCall.Type,
-				"function": map[string]interface{}{
-					"name":      toolCall.Function.Name,
-					"arguments": toolCall.Function.Arguments,
-				},
-			},
-		}
+		delta["tool_calls"] = []map[string]interface{}{toolCall}
 	}
 
 	return map[string]interface{}{
-		"id":      "chatcmpl-" + time.Now().Format("20060102150405"),
+		"id":      c.id,
 		"object":  "chat.completion.chunk",
-		"created": time.Now().Unix(),
-		"model":   "bedrock-claude",
+		"created": c.created,
+		"model":   c.model,
 		"choices": []map[string]interface{}{
 			{
 				"index":         0,
@@ -44,6 +55,72 @@ func createOpenAIChunk(content string, toolCall *bedrock.ToolCall) map[string]in
 	}
 }
 
+// createOpenAIFinishChunk builds the last choice chunk of a stream, with an
+// empty delta and the reason generation stopped
+func createOpenAIFinishChunk(c completion, finishReason string) map[string]interface{} {
+	chunk := createOpenAIChunk(c, "", nil)
+	chunk["choices"].([]map[string]interface{})[0]["finish_reason"] = finishReason
+	return chunk
+}
+
+// finishReason maps a Bedrock stop reason to the OpenAI finish_reason
+func finishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "content_filtered", "guardrail_intervened":
+		return "content_filter"
+	default:
+		// end_turn and stop_sequence
+		return "stop"
+	}
+}
+
+// createOpenAIUsageChunk builds the final usage chunk OpenAI sends when
+// stream_options.include_usage is set, with an empty choices list
+func createOpenAIUsageChunk(c completion, usage bedrock.Usage) map[string]interface{} {
+	return map[string]interface{}{
+		"id":      c.id,
+		"object":  "chat.completion.chunk",
+		"created": c.created,
+		"model":   c.model,
+		"choices": []map[string]interface{}{},
+		"usage": map[string]interface{}{
+			"prompt_tokens":     usage.InputTokens,
+			"completion_tokens": usage.OutputTokens,
+			"total_tokens":      usage.TotalTokens,
+		},
+	}
+}
+
+// createToolCallDelta builds one streamed tool_calls entry. The ID, type and
+// name are only sent when the call starts, later fragments carry just the
+// index and the next piece of the arguments.
+func createToolCallDelta(index int, id, name, arguments string) map[string]interface{} {
+	function := map[string]interface{}{
+		"arguments": arguments,
+	}
+	toolCall := map[string]interface{}{
+		"index":    index,
+		"function": function,
+	}
+	if id != "" {
+		toolCall["id"] = id
+		toolCall["type"] = "function"
+		function["name"] = name
+	}
+	return toolCall
+}
+
+// setStreamHeaders sets the SSE response headers, before the first chunk is written
+func setStreamHeaders(w http.ResponseWriter, completionID string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Transfer-Encoding", "chunked")
+	w.Header().Set("x-request-id", completionID)
+}
+
 func sendOpenAIChunk(openAIChunk map[string]interface{}, w http.ResponseWriter) error {
 	chunkJSON, err := json.Marshal(openAIChunk)
 	if err != nil {
@@ -52,20 +129,34 @@ func sendOpenAIChunk(openAIChunk map[string]interface{}, w http.ResponseWriter)
 	}
 
 	dataStr := fmt.Sprintf("data: %s\n\n", string(chunkJSON))
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Transfer-Encoding", "chunked")
-	w.Header().Set("x-request-id", openAIChunk["id"].(string))
 
 	logrus.Infof("OpenAI chunk: %s", string(dataStr))
 
 	if _, err := w.Write([]byte(dataStr)); err != nil {
 		return err
 	}
-	w.(http.Flusher).Flush()
+	return flush(w)
+}
+
+// sendDone terminates the SSE stream
+func sendDone(w http.ResponseWriter) error {
+	if _, err := w.Write([]byte("data: [DONE]\n\n")); err != nil {
+		return err
+	}
+	return flush(w)
+}
+
+// flush sends what was written so far to the client, failing when the writer can't stream
+func flush(w http.ResponseWriter) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("streaming not supported by the response writer")
+	}
+	flusher.Flush()
 	return nil
 }
 
-func createOpenAIResponse(bedrockBody bedrock.Response) map[string]interface{} {
+func createOpenAIResponse(c completion, bedrockBody bedrock.Response) map[string]interface{} {
 	messageContent := ""
 	var toolCalls []map[string]interface{}
 
@@ -79,7 +170,7 @@ func createOpenAIResponse(bedrockBody bedrock.Response) map[string]interface{} {
 				"type": "function",
 				"function": map[string]interface{}{
 					"name":      item.ToolUse.Name,
-					"arguments": item.ToolUse.Input,
+					"arguments": string(item.ToolUse.Input),
 				},
 			}
 			toolCalls = append(toolCalls, toolCall)
@@ -96,15 +187,15 @@ func createOpenAIResponse(bedrockBody bedrock.Response) map[string]interface{} {
 	}
 
 	return map[string]interface{}{
-		"id":      "chatcmpl-" + time.Now().Format("20060102150405"),
+		"id":      c.id,
 		"object":  "chat.completion",
-		"created": time.Now().Unix(),
-		"model":   "bedrock-claude",
+		"created": c.created,
+		"model":   c.model,
 		"choices": []map[string]interface{}{
 			{
 				"index":         0,
 				"message":       message,
-				"finish_reason": bedrockBody.StopReason,
+				"finish_reason": finishReason(bedrockBody.StopReason),
 			},
 		},
 		"usage": map[string]interface{}{
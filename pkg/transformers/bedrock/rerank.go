@@ -0,0 +1,62 @@
+package bedrock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/robertprast/goop/pkg/openai_schema"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// rerankRequest is the InvokeModel body of the Cohere and Amazon rerank models
+type rerankRequest struct {
+	Query      string   `json:"query"`
+	Documents  []string `json:"documents"`
+	TopN       *int     `json:"top_n,omitempty"`
+	APIVersion int      `json:"api_version,omitempty"`
+}
+
+// TransformRerankRequest converts a rerank request to the InvokeModel body of
+// a Bedrock rerank model
+func (e *BedrockProxy) TransformRerankRequest(ctx context.Context, reqBody openai_schema.RerankRequest) ([]byte, error) {
+	if !strings.Contains(reqBody.Model, "rerank") {
+		return nil, fmt.Errorf("model %s is not a rerank model", reqBody.Model)
+	}
+	req := rerankRequest{
+		Query:     reqBody.Query,
+		Documents: reqBody.Documents,
+		TopN:      reqBody.TopN,
+	}
+	// Cohere models on Bedrock require the API version in the body
+	if strings.Contains(reqBody.Model, "cohere.") {
+		req.APIVersion = 2
+	}
+	return json.Marshal(req)
+}
+
+// HandleRerankRequest sends the rerank request to InvokeModel
+func (e *BedrockProxy) HandleRerankRequest(ctx context.Context, model string, transformedBody []byte) (*http.Response, error) {
+	return e.post(ctx, model, "invoke", transformedBody)
+}
+
+// SendRerankResponse writes the normalized rerank results
+func (e *BedrockProxy) SendRerankResponse(ctx context.Context, bedrockResp *http.Response, w http.ResponseWriter) error {
+	if bedrockResp.StatusCode != http.StatusOK {
+		return e.handleErrorResponse(bedrockResp, w)
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(bedrockResp.Body)
+
+	var rerankResp openai_schema.RerankResponse
+	if err := json.NewDecoder(bedrockResp.Body).Decode(&rerankResp); err != nil {
+		return fmt.Errorf("error decoding Bedrock rerank response: %w", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(rerankResp)
+}
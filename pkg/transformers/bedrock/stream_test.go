@@ -0,0 +1,402 @@
+package bedrock
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+	"github.com/robertprast/goop/pkg/engine/bedrock"
+)
+
+// streamEvent is one converse-stream event, encoded into the upstream body
+type streamEvent struct {
+	eventType string
+	payload   string
+}
+
+// encodeEvent encodes event as an event stream message
+func encodeEvent(t *testing.T, event streamEvent) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	msg := eventstream.Message{
+		Headers: eventstream.Headers{
+			{Name: ":event-type", Value: eventstream.StringValue(event.eventType)},
+		},
+		Payload: []byte(event.payload),
+	}
+	if err := eventstream.NewEncoder().Encode(&buf, msg); err != nil {
+		t.Fatalf("error encoding event: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func eventStreamResponse(t *testing.T, events []streamEvent) *http.Response {
+	t.Helper()
+	var body bytes.Buffer
+	for _, event := range events {
+		body.Write(encodeEvent(t, event))
+	}
+	return streamResponse(io.NopCloser(&body))
+}
+
+func streamResponse(body io.ReadCloser) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/vnd.amazon.eventstream"}},
+		Body:       body,
+	}
+}
+
+// pacedBody delivers one encoded event at a time, waiting gap before each,
+// like a model generating tokens
+type pacedBody struct {
+	events  [][]byte
+	current []byte
+	gap     time.Duration
+}
+
+func (p *pacedBody) Read(b []byte) (int, error) {
+	if len(p.current) == 0 {
+		if len(p.events) == 0 {
+			return 0, io.EOF
+		}
+		time.Sleep(p.gap)
+		p.current, p.events = p.events[0], p.events[1:]
+	}
+	n := copy(b, p.current)
+	p.current = p.current[n:]
+	return n, nil
+}
+
+func (p *pacedBody) Close() error { return nil }
+
+// streamChunk is the part of a chat.completion.chunk the tests look at
+type streamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Type     string `json:"type"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// readChunks parses an SSE body into its chunks, failing unless it ends with [DONE]
+func readChunks(t *testing.T, body string) []streamChunk {
+	t.Helper()
+	var chunks []streamChunk
+	done := false
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if done {
+			t.Fatalf("data after [DONE]: %s", data)
+		}
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk streamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("error decoding chunk %s: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if !done {
+		t.Fatal("stream did not end with [DONE]")
+	}
+	return chunks
+}
+
+func TestStreamToolCallWithFinishReason(t *testing.T) {
+	events := []streamEvent{
+		{"messageStart", `{"role":"assistant"}`},
+		{"contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"Let me check."}}`},
+		{"contentBlockStop", `{"contentBlockIndex":0}`},
+		{"contentBlockStart", `{"contentBlockIndex":1,"start":{"toolUse":{"toolUseId":"tooluse_1","name":"get_weather"}}}`},
+		{"contentBlockDelta", `{"contentBlockIndex":1,"delta":{"toolUse":{"input":"{\"city\": "}}}`},
+		{"contentBlockDelta", `{"contentBlockIndex":1,"delta":{"toolUse":{"input":"\"Paris\", \"unit\""}}}`},
+		{"contentBlockDelta", `{"contentBlockIndex":1,"delta":{"toolUse":{"input":": \"celsius\"}"}}}`},
+		{"contentBlockStop", `{"contentBlockIndex":1}`},
+		{"messageStop", `{"stopReason":"tool_use"}`},
+		{"metadata", `{"usage":{"inputTokens":10,"outputTokens":20,"totalTokens":30}}`},
+	}
+
+	for _, window := range []time.Duration{0, 10 * time.Millisecond} {
+		t.Run("coalesce window "+window.String(), func(t *testing.T) {
+			proxy := &BedrockProxy{
+				BedrockEngine: &bedrock.BedrockEngine{StreamCoalesceWindow: window},
+				includeUsage:  true,
+				model:         "bedrock/anthropic.claude-3-haiku-20240307-v1:0",
+			}
+			rec := httptest.NewRecorder()
+			if err := proxy.SendChatCompletionResponse(context.Background(), eventStreamResponse(t, events), rec, true); err != nil {
+				t.Fatalf("SendChatCompletionResponse() error = %v", err)
+			}
+
+			chunks := readChunks(t, rec.Body.String())
+			var content, id, name, arguments string
+			var finishReasons []string
+			usageAfterFinish := false
+			for _, chunk := range chunks {
+				if chunk.Usage != nil {
+					usageAfterFinish = len(finishReasons) == 1 && chunk.Usage.TotalTokens == 30
+					continue
+				}
+				choice := chunk.Choices[0]
+				content += choice.Delta.Content
+				for _, call := range choice.Delta.ToolCalls {
+					if call.Index != 0 {
+						t.Errorf("tool call index = %d, want 0", call.Index)
+					}
+					if call.ID != "" {
+						id, name = call.ID, call.Function.Name
+					}
+					arguments += call.Function.Arguments
+				}
+				if choice.FinishReason != nil {
+					finishReasons = append(finishReasons, *choice.FinishReason)
+				}
+			}
+
+			if content != "Let me check." {
+				t.Errorf("content = %q", content)
+			}
+			if id != "tooluse_1" || name != "get_weather" {
+				t.Errorf("tool call id, name = %q, %q", id, name)
+			}
+			var args map[string]string
+			if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+				t.Fatalf("arguments %q are not valid JSON: %v", arguments, err)
+			}
+			if args["city"] != "Paris" || args["unit"] != "celsius" {
+				t.Errorf("arguments = %v", args)
+			}
+			if len(finishReasons) != 1 || finishReasons[0] != "tool_calls" {
+				t.Errorf("finish reasons = %v, want [tool_calls]", finishReasons)
+			}
+			if !usageAfterFinish {
+				t.Error("usage chunk missing or sent before the finish reason")
+			}
+		})
+	}
+}
+
+func TestFinishReason(t *testing.T) {
+	tests := map[string]string{
+		"end_turn":             "stop",
+		"stop_sequence":        "stop",
+		"max_tokens":           "length",
+		"tool_use":             "tool_calls",
+		"content_filtered":     "content_filter",
+		"guardrail_intervened": "content_filter",
+		"":                     "stop",
+	}
+	for stopReason, want := range tests {
+		if got := finishReason(stopReason); got != want {
+			t.Errorf("finishReason(%q) = %q, want %q", stopReason, got, want)
+		}
+	}
+}
+
+func TestCreateOpenAIResponseFinishReason(t *testing.T) {
+	var resp bedrock.Response
+	body := `{"output":{"message":{"role":"assistant","content":[{"toolUse":{"toolUseId":"tooluse_1","name":"get_weather","input":{"city":"Paris"}}}]}},"stopReason":"tool_use"}`
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatal(err)
+	}
+	openAIResp := createOpenAIResponse(newCompletion("bedrock/model"), resp)
+	choice := openAIResp["choices"].([]map[string]interface{})[0]
+	if got := choice["finish_reason"]; got != "tool_calls" {
+		t.Errorf("finish_reason = %v, want tool_calls", got)
+	}
+}
+
+func TestStreamCoalescing(t *testing.T) {
+	const deltas = 20
+	events := []streamEvent{{"messageStart", `{"role":"assistant"}`}}
+	var want strings.Builder
+	for i := 0; i < deltas; i++ {
+		text := fmt.Sprintf("word%d ", i)
+		want.WriteString(text)
+		events = append(events, streamEvent{"contentBlockDelta", fmt.Sprintf(`{"contentBlockIndex":0,"delta":{"text":%q}}`, text)})
+	}
+	events = append(events,
+		streamEvent{"contentBlockStop", `{"contentBlockIndex":0}`},
+		streamEvent{"messageStop", `{"stopReason":"end_turn"}`},
+	)
+
+	// textChunks streams the events 2ms apart and returns the text of every chunk carrying some
+	textChunks := func(window time.Duration) []string {
+		body := &pacedBody{gap: 2 * time.Millisecond}
+		for _, event := range events {
+			body.events = append(body.events, encodeEvent(t, event))
+		}
+		proxy := &BedrockProxy{
+			BedrockEngine: &bedrock.BedrockEngine{StreamCoalesceWindow: window},
+			model:         "bedrock/anthropic.claude-3-haiku-20240307-v1:0",
+		}
+		rec := httptest.NewRecorder()
+		if err := proxy.SendChatCompletionResponse(context.Background(), streamResponse(body), rec, true); err != nil {
+			t.Fatalf("SendChatCompletionResponse() error = %v", err)
+		}
+		var texts []string
+		for _, chunk := range readChunks(t, rec.Body.String()) {
+			if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+				texts = append(texts, chunk.Choices[0].Delta.Content)
+			}
+		}
+		return texts
+	}
+
+	uncoalesced := textChunks(0)
+	if len(uncoalesced) != deltas {
+		t.Errorf("without coalescing got %d text chunks, want %d", len(uncoalesced), deltas)
+	}
+	coalesced := textChunks(25 * time.Millisecond)
+	if len(coalesced) == 0 || len(coalesced) > deltas/2 {
+		t.Errorf("with a 25ms window got %d text chunks, want between 1 and %d", len(coalesced), deltas/2)
+	}
+	for name, texts := range map[string][]string{"uncoalesced": uncoalesced, "coalesced": coalesced} {
+		if got := strings.Join(texts, ""); got != want.String() {
+			t.Errorf("%s content = %q, want %q", name, got, want.String())
+		}
+	}
+}
+
+func TestStreamIncludeUsage(t *testing.T) {
+	events := []streamEvent{
+		{"messageStart", `{"role":"assistant"}`},
+		{"contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"Hi"}}`},
+		{"contentBlockStop", `{"contentBlockIndex":0}`},
+		{"messageStop", `{"stopReason":"end_turn"}`},
+		{"metadata", `{"usage":{"inputTokens":4,"outputTokens":1,"totalTokens":5}}`},
+	}
+	tests := []struct {
+		name          string
+		streamOptions string
+		wantUsage     bool
+	}{
+		{"include_usage", `,"stream_options":{"include_usage":true}`, true},
+		{"include_usage false", `,"stream_options":{"include_usage":false}`, false},
+		{"no stream_options", ``, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := &BedrockProxy{BedrockEngine: &bedrock.BedrockEngine{}}
+			reqBody := parseRequest(t, `{"model":"bedrock/anthropic.claude-3-haiku-20240307-v1:0","stream":true,"messages":[{"role":"user","content":"hi"}]`+tt.streamOptions+`}`)
+			if _, err := proxy.TransformChatCompletionRequest(context.Background(), reqBody); err != nil {
+				t.Fatalf("TransformChatCompletionRequest() error = %v", err)
+			}
+			rec := httptest.NewRecorder()
+			if err := proxy.SendChatCompletionResponse(context.Background(), eventStreamResponse(t, events), rec, true); err != nil {
+				t.Fatalf("SendChatCompletionResponse() error = %v", err)
+			}
+
+			chunks := readChunks(t, rec.Body.String())
+			var usage []int
+			for i, chunk := range chunks {
+				if chunk.Usage == nil {
+					continue
+				}
+				usage = append(usage, chunk.Usage.TotalTokens)
+				if i != len(chunks)-1 || len(chunk.Choices) != 0 {
+					t.Errorf("usage chunk %d of %d has %d choices, want the last chunk with none", i+1, len(chunks), len(chunk.Choices))
+				}
+			}
+			if tt.wantUsage && (len(usage) != 1 || usage[0] != 5) {
+				t.Errorf("usage chunks = %v, want one with 5 total tokens", usage)
+			}
+			if !tt.wantUsage && len(usage) != 0 {
+				t.Errorf("usage chunks = %v, want none", usage)
+			}
+		})
+	}
+}
+
+func TestStreamErrorBeforeStreaming(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		wantMessage string
+	}{
+		{"throttled", http.StatusTooManyRequests, `{"message":"Too many requests, please wait before trying again."}`, "Too many requests, please wait before trying again."},
+		{"validation", http.StatusBadRequest, `{"message":"The provided model identifier is invalid."}`, "The provided model identifier is invalid."},
+		{"plain text", http.StatusInternalServerError, "internal failure\n", "internal failure"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := &BedrockProxy{BedrockEngine: &bedrock.BedrockEngine{}}
+			resp := &http.Response{
+				StatusCode: tt.status,
+				Status:     http.StatusText(tt.status),
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(tt.body)),
+			}
+			rec := httptest.NewRecorder()
+			if err := proxy.SendChatCompletionResponse(context.Background(), resp, rec, true); err != nil {
+				t.Fatalf("SendChatCompletionResponse() error = %v", err)
+			}
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Content-Type = %q, want a JSON error instead of an event stream", contentType)
+			}
+			var errResp struct {
+				Error struct {
+					Message string `json:"message"`
+					Type    string `json:"type"`
+					Code    string `json:"code"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil {
+				t.Fatalf("error decoding %s: %v", rec.Body, err)
+			}
+			if errResp.Error.Message != tt.wantMessage || errResp.Error.Code != "upstream_error" {
+				t.Errorf("error = %+v, want message %q with code upstream_error", errResp.Error, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestStreamUnexpectedContentType(t *testing.T) {
+	proxy := &BedrockProxy{BedrockEngine: &bedrock.BedrockEngine{}}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"output":{}}`)),
+	}
+	rec := httptest.NewRecorder()
+	if err := proxy.SendChatCompletionResponse(context.Background(), resp, rec, true); err == nil {
+		t.Fatal("SendChatCompletionResponse() accepted a JSON body for a stream")
+	}
+	if rec.Body.Len() != 0 || rec.Header().Get("Content-Type") == "text/event-stream" {
+		t.Errorf("wrote %q with headers %v before failing, want nothing so the proxy can answer with an error", rec.Body, rec.Header())
+	}
+}
@@ -1,6 +1,7 @@
 package bedrock
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -8,6 +9,8 @@ import (
 	"github.com/robertprast/goop/pkg/openai_schema"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
 	"github.com/sirupsen/logrus"
@@ -49,6 +52,14 @@ func buildToolConfig(reqBody openai_schema.IncomingChatCompletionRequest) *bedro
 			toolConfig.ToolChoice = bedrock.ToolChoice{Auto: &struct{}{}}
 		case "required":
 			toolConfig.ToolChoice = bedrock.ToolChoice{Any: &struct{}{}}
+		case "none":
+			// Converse has no "none", leaving the tools out stops the model calling them.
+			// Conversations with tool calls need the tools defined, so they fall back to auto.
+			if !hasToolUse(reqBody.Messages) {
+				return nil
+			}
+			logrus.Warn("tool_choice \"none\" can't be enforced by Bedrock once the conversation has tool calls, using auto")
+			toolConfig.ToolChoice = bedrock.ToolChoice{Auto: &struct{}{}}
 		}
 	case map[string]interface{}:
 		if tool, ok := choice["function"].(map[string]interface{}); ok {
@@ -60,54 +71,241 @@ func buildToolConfig(reqBody openai_schema.IncomingChatCompletionRequest) *bedro
 	return toolConfig
 }
 
+// hasToolUse reports whether the conversation contains tool calls or tool results
+func hasToolUse(messages []openai_schema.ChatMessage) bool {
+	for _, msg := range messages {
+		if len(msg.ToolCalls) > 0 || msg.Role == "tool" {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultSystemPrompt is sent when the request has no system messages
+const defaultSystemPrompt = "You are an assistant."
+
+// splitSystemMessages moves every system message, wherever it appears, into
+// Bedrock's system array and returns the remaining conversation
+func splitSystemMessages(messages []openai_schema.ChatMessage) ([]bedrock.SystemMessage, []openai_schema.ChatMessage) {
+	var system []bedrock.SystemMessage
+	conversation := make([]openai_schema.ChatMessage, 0, len(messages))
+	for _, message := range messages {
+		if message.Role != "system" {
+			conversation = append(conversation, message)
+			continue
+		}
+		if message.Content != nil && *message.Content != "" {
+			system = append(system, bedrock.SystemMessage{Text: *message.Content})
+		}
+		for _, part := range message.ContentParts {
+			if part.Type == "text" && part.Text != "" {
+				system = append(system, bedrock.SystemMessage{Text: part.Text})
+			}
+		}
+	}
+	if len(system) == 0 {
+		system = []bedrock.SystemMessage{{Text: defaultSystemPrompt}}
+	}
+	return system, conversation
+}
+
 // transformMessages converts the OpenAI-style messages into Bedrock-compatible messages.
-func transformMessages(messages []openai_schema.ChatMessage) []bedrock.Message {
-	bedrockMessages := make([]bedrock.Message, len(messages))
+// Assistant tool calls become toolUse blocks and tool messages become toolResult
+// blocks in a user message, consecutive tool results sharing one message.
+func transformMessages(ctx context.Context, messages []openai_schema.ChatMessage, httpsOnlyImages bool) ([]bedrock.Message, error) {
+	bedrockMessages := make([]bedrock.Message, 0, len(messages))
 	for i, message := range messages {
+		if message.Role == "tool" {
+			block := bedrock.ContentBlock{ToolResult: toolResultBlock(message)}
+			last := len(bedrockMessages) - 1
+			if i > 0 && messages[i-1].Role == "tool" {
+				bedrockMessages[last].Content = append(bedrockMessages[last].Content, block)
+			} else {
+				bedrockMessages = append(bedrockMessages, bedrock.Message{
+					Role:    "user",
+					Content: []bedrock.ContentBlock{block},
+				})
+			}
+			continue
+		}
+
 		var contentBlocks []bedrock.ContentBlock
 
-		if message.Content != nil {
+		if message.Content != nil && *message.Content != "" {
 			contentBlocks = append(contentBlocks, bedrock.ContentBlock{
 				Text: *message.Content,
 			})
 		}
 
+		for _, part := range message.ContentParts {
+			switch part.Type {
+			case "text":
+				contentBlocks = append(contentBlocks, bedrock.ContentBlock{
+					Text: part.Text,
+				})
+			case "image_url":
+				image, err := processImageURL(ctx, part.ImageURL.URL, httpsOnlyImages)
+				if err != nil {
+					return nil, fmt.Errorf("message at index %d: %w", i, err)
+				}
+				contentBlocks = append(contentBlocks, bedrock.ContentBlock{
+					Image: image,
+				})
+			}
+		}
+
 		if message.Type != nil && *message.Type == "image_url" {
-			resp, err := http.Get(message.ImageURL.URL)
+			image, err := processImageURL(ctx, message.ImageURL.URL, httpsOnlyImages)
 			if err != nil {
-				panic(err)
+				return nil, fmt.Errorf("message at index %d: %w", i, err)
 			}
-			imageBytes, err := io.ReadAll(resp.Body)
+			contentBlocks = append(contentBlocks, bedrock.ContentBlock{
+				Image: image,
+			})
+		}
+
+		for _, toolCall := range message.ToolCalls {
+			toolUse, err := toolUseBlock(toolCall)
 			if err != nil {
-				panic(err)
-			}
-			var textContent string
-			if imageBytes != nil {
-				textContent = base64.StdEncoding.EncodeToString(imageBytes)
+				return nil, fmt.Errorf("message at index %d: %w", i, err)
 			}
 			contentBlocks = append(contentBlocks, bedrock.ContentBlock{
-				Image: &bedrock.Image{
-					Format: "jpeg",
-					Source: bedrock.ImageSource{
-						Bytes: textContent,
-					},
-				},
+				ToolUse: toolUse,
 			})
 		}
 
-		bedrockMessages[i] = bedrock.Message{
+		bedrockMessages = append(bedrockMessages, bedrock.Message{
 			Role:    message.Role,
 			Content: contentBlocks,
+		})
+	}
+	return bedrockMessages, nil
+}
+
+// toolUseBlock converts an assistant tool call, whose arguments must be a JSON object
+func toolUseBlock(toolCall openai_schema.ToolCall) (*bedrock.ToolUse, error) {
+	arguments := strings.TrimSpace(toolCall.Function.Arguments)
+	if arguments == "" {
+		arguments = "{}"
+	}
+	var input map[string]interface{}
+	if err := json.Unmarshal([]byte(arguments), &input); err != nil {
+		return nil, fmt.Errorf("tool call %s arguments must be a JSON object: %w", toolCall.ID, err)
+	}
+	return &bedrock.ToolUse{
+		ToolUseId: toolCall.ID,
+		Name:      toolCall.Function.Name,
+		Input:     json.RawMessage(arguments),
+	}, nil
+}
+
+// toolResultBlock converts a tool message answering the tool call in its tool_call_id
+func toolResultBlock(message openai_schema.ChatMessage) *bedrock.ToolResult {
+	var content []bedrock.ToolResultContent
+	if message.Content != nil {
+		content = append(content, bedrock.ToolResultContent{Text: *message.Content})
+	}
+	for _, part := range message.ContentParts {
+		if part.Type == "text" {
+			content = append(content, bedrock.ToolResultContent{Text: part.Text})
+		}
+	}
+	return &bedrock.ToolResult{
+		ToolUseId: *message.ToolCallID,
+		Content:   content,
+	}
+}
+
+// processImageURL resolves an image_url into a Bedrock image block. Data URIs
+// are decoded inline, http(s) URLs are fetched. When httpsOnly is set,
+// plaintext http:// URLs are rejected.
+func processImageURL(ctx context.Context, imageURL string, httpsOnly bool) (*bedrock.Image, error) {
+	parsed, err := url.Parse(imageURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image url: %w", err)
+	}
+
+	switch parsed.Scheme {
+	case "data":
+		return decodeDataURI(imageURL)
+	case "https":
+	case "http":
+		if httpsOnly {
+			return nil, fmt.Errorf("image url must use https")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported image url scheme %q", parsed.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating image request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching image: %w", err)
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
 		}
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching image: status %d", resp.StatusCode)
+	}
+
+	imageBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading image: %w", err)
+	}
+
+	return &bedrock.Image{
+		Format: imageFormat(resp.Header.Get("Content-Type")),
+		Source: bedrock.ImageSource{
+			Bytes: base64.StdEncoding.EncodeToString(imageBytes),
+		},
+	}, nil
+}
+
+// decodeDataURI parses a base64 `data:image/<format>;base64,<data>` URI.
+func decodeDataURI(uri string) (*bedrock.Image, error) {
+	header, data, found := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !found || !strings.HasSuffix(header, ";base64") {
+		return nil, fmt.Errorf("image data uri must be base64 encoded")
+	}
+	if _, err := base64.StdEncoding.DecodeString(data); err != nil {
+		return nil, fmt.Errorf("invalid base64 in image data uri: %w", err)
+	}
+
+	return &bedrock.Image{
+		Format: imageFormat(strings.TrimSuffix(header, ";base64")),
+		Source: bedrock.ImageSource{
+			Bytes: data,
+		},
+	}, nil
+}
+
+// imageFormat maps an image MIME type to a Bedrock image format, defaulting to jpeg.
+func imageFormat(mimeType string) string {
+	switch strings.TrimSpace(strings.Split(mimeType, ";")[0]) {
+	case "image/png":
+		return "png"
+	case "image/gif":
+		return "gif"
+	case "image/webp":
+		return "webp"
+	default:
+		return "jpeg"
 	}
-	return bedrockMessages
 }
 
 // buildInferenceConfig generates a Bedrock-compatible inference configuration from the OpenAI engine_proxy request.
 func buildInferenceConfig(reqBody openai_schema.IncomingChatCompletionRequest) bedrock.InferenceConfig {
 	config := bedrock.InferenceConfig{}
-	if reqBody.MaxTokens != nil {
-		config.MaxTokens = *reqBody.MaxTokens
+	if maxTokens := reqBody.OutputTokenLimit(); maxTokens != nil {
+		config.MaxTokens = *maxTokens
 	}
 	if reqBody.Temperature != nil {
 		config.Temperature = *reqBody.Temperature
@@ -119,31 +317,80 @@ func buildInferenceConfig(reqBody openai_schema.IncomingChatCompletionRequest) b
 	} else {
 		config.TopP = 1.0
 	}
-	if reqBody.Stop != nil {
-		config.StopSequences = []string{*reqBody.Stop}
+	if reqBody.TopK != nil {
+		config.TopK = *reqBody.TopK
+	}
+	if len(reqBody.Stop) > 0 {
+		config.StopSequences = reqBody.Stop
 	}
 	return config
 }
 
-func processStreamingEvent(event eventstream.Message, w http.ResponseWriter) error {
+// streamState tracks a converse stream across events
+type streamState struct {
+	completion   completion
+	includeUsage bool
+	// toolCalls maps Bedrock content block indexes to OpenAI tool call indexes
+	toolCalls map[int]int
+}
+
+func newStreamState(model string, includeUsage bool) *streamState {
+	return &streamState{
+		completion:   newCompletion(model),
+		includeUsage: includeUsage,
+		toolCalls:    map[int]int{},
+	}
+}
+
+// toolCallIndex returns the OpenAI tool call index for a content block,
+// assigning the next one the first time the block is seen
+func (s *streamState) toolCallIndex(contentBlockIndex int) (int, bool) {
+	if index, ok := s.toolCalls[contentBlockIndex]; ok {
+		return index, false
+	}
+	index := len(s.toolCalls)
+	s.toolCalls[contentBlockIndex] = index
+	return index, true
+}
+
+func processStreamingEvent(event eventstream.Message, w http.ResponseWriter, state *streamState) error {
 	eventType := getEventType(event.Headers)
 	switch eventType {
-	case "messageStart":
+	case "messageStart", "contentBlockStop":
 		// No action needed
-	case "messageEnd":
-		_, err := w.Write([]byte("[DONE]\n\n"))
-		if err != nil {
-			return err
+	case "messageStop":
+		return handleMessageStop(event, w, state)
+	case "contentBlockStart":
+		return handleContentBlockStart(event, w, state)
+	case "metadata":
+		if state.includeUsage {
+			return handleMetadata(event, w, state)
 		}
 	case "contentBlockDelta":
-		return handleContentBlockDelta(event, w)
+		return handleContentBlockDelta(event, w, state)
 	default:
 		logrus.Warnf("Unknown event type: %s", eventType)
 	}
 	return nil
 }
 
-func handleContentBlockDelta(event eventstream.Message, w http.ResponseWriter) error {
+// handleContentBlockStart announces a tool call with its ID and name
+func handleContentBlockStart(event eventstream.Message, w http.ResponseWriter, state *streamState) error {
+	var payload bedrock.ContentBlockStartEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		logrus.Warnf("Error unmarshaling payload: %v", err)
+		return nil
+	}
+	toolUse := payload.Start.ToolUse
+	if toolUse == nil {
+		return nil
+	}
+	index, _ := state.toolCallIndex(payload.ContentBlockIndex)
+	toolCall := createToolCallDelta(index, toolUse.ToolUseId, toolUse.Name, "")
+	return sendOpenAIChunk(createOpenAIChunk(state.completion, "", toolCall), w)
+}
+
+func handleContentBlockDelta(event eventstream.Message, w http.ResponseWriter, state *streamState) error {
 	var payload bedrock.CustomContentBlockDeltaEvent
 	if err := json.Unmarshal(event.Payload, &payload); err != nil {
 		logrus.Warnf("Error unmarshaling payload: %v", err)
@@ -151,27 +398,42 @@ func handleContentBlockDelta(event eventstream.Message, w http.ResponseWriter) e
 	}
 	logrus.Infof("Raw response from bedrock: %v", string(payload.Delta))
 
-	content, toolCall, err := extractContentOrToolCall(payload.Delta)
-	if err != nil {
-		return err
+	var delta bedrock.ContentBlockDelta
+	if err := json.Unmarshal(payload.Delta, &delta); err != nil {
+		return fmt.Errorf("failed to unmarshal delta: %w", err)
 	}
 
-	openAIChunk := createOpenAIChunk(content, toolCall)
-	return sendOpenAIChunk(openAIChunk, w)
+	switch {
+	case delta.ToolUse != nil:
+		index, started := state.toolCallIndex(payload.ContentBlockIndex)
+		if started {
+			logrus.Warnf("Tool use delta for content block %d arrived before its start", payload.ContentBlockIndex)
+		}
+		toolCall := createToolCallDelta(index, "", "", delta.ToolUse.Value)
+		return sendOpenAIChunk(createOpenAIChunk(state.completion, "", toolCall), w)
+	case delta.Text != nil && *delta.Text != "":
+		return sendOpenAIChunk(createOpenAIChunk(state.completion, *delta.Text, nil), w)
+	}
+	return nil
 }
 
-func extractContentOrToolCall(delta json.RawMessage) (string, *bedrock.ToolCall, error) {
-	var textDelta bedrock.TextDelta
-	if err := json.Unmarshal(delta, &textDelta); err == nil {
-		return textDelta.Value, nil, nil
+// handleMessageStop sends the final chunk carrying the finish reason
+func handleMessageStop(event eventstream.Message, w http.ResponseWriter, state *streamState) error {
+	var payload bedrock.MessageStopEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		logrus.Warnf("Error unmarshaling messageStop payload: %v", err)
 	}
+	return sendOpenAIChunk(createOpenAIFinishChunk(state.completion, finishReason(payload.StopReason)), w)
+}
 
-	var toolCall bedrock.ToolCall
-	if err := json.Unmarshal(delta, &toolCall); err == nil {
-		return "", &toolCall, nil
+// handleMetadata sends the OpenAI usage chunk for stream_options.include_usage
+func handleMetadata(event eventstream.Message, w http.ResponseWriter, state *streamState) error {
+	var payload bedrock.MetadataEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		logrus.Warnf("Error unmarshaling metadata payload: %v", err)
+		return nil
 	}
-
-	return "", nil, fmt.Errorf("failed to unmarshal delta")
+	return sendOpenAIChunk(createOpenAIUsageChunk(state.completion, payload.Usage), w)
 }
 
 func getEventType(headers []eventstream.Header) string {
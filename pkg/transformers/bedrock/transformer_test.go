@@ -0,0 +1,193 @@
+package bedrock
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/robertprast/goop/pkg/engine/bedrock"
+	"github.com/robertprast/goop/pkg/openai_schema"
+)
+
+// parseRequest decodes a chat completion request the way the proxy does
+func parseRequest(t *testing.T, body string) openai_schema.IncomingChatCompletionRequest {
+	t.Helper()
+	var reqBody openai_schema.IncomingChatCompletionRequest
+	if err := json.Unmarshal([]byte(body), &reqBody); err != nil {
+		t.Fatalf("error parsing request: %v", err)
+	}
+	return reqBody
+}
+
+const weatherTool = `[{"type":"function","function":{"name":"get_weather","description":"Get the weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}}]`
+
+func TestBuildToolConfigToolChoice(t *testing.T) {
+	userTurn := `[{"role":"user","content":"Weather in Paris?"}]`
+	toolTurn := `[{"role":"user","content":"Weather in Paris?"},` +
+		`{"role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}]},` +
+		`{"role":"tool","tool_call_id":"call_1","content":"sunny"}]`
+
+	tests := []struct {
+		name       string
+		messages   string
+		toolChoice string
+		// want is the marshaled toolChoice, empty when no tool config is sent
+		want string
+	}{
+		{"omitted", userTurn, ``, `{}`},
+		{"auto", userTurn, `"auto"`, `{"auto":{}}`},
+		{"required", userTurn, `"required"`, `{"any":{}}`},
+		{"function", userTurn, `{"type":"function","function":{"name":"get_weather"}}`, `{"tool":{"name":"get_weather"}}`},
+		{"none drops the tools", userTurn, `"none"`, ``},
+		{"none with tool use falls back to auto", toolTurn, `"none"`, `{"auto":{}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"model":"bedrock/anthropic.claude-3-haiku","messages":` + tt.messages + `,"tools":` + weatherTool
+			if tt.toolChoice != "" {
+				body += `,"tool_choice":` + tt.toolChoice
+			}
+			toolConfig := buildToolConfig(parseRequest(t, body+`}`))
+
+			if tt.want == "" {
+				if toolConfig != nil {
+					t.Fatalf("toolConfig = %+v, want nil", toolConfig)
+				}
+				return
+			}
+			if toolConfig == nil || len(toolConfig.Tools) != 1 {
+				t.Fatalf("toolConfig = %+v, want the get_weather tool", toolConfig)
+			}
+			got, err := json.Marshal(toolConfig.ToolChoice)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("toolChoice = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildToolConfigWithoutTools(t *testing.T) {
+	reqBody := parseRequest(t, `{"model":"bedrock/anthropic.claude-3-haiku","messages":[{"role":"user","content":"hi"}],"tool_choice":"required"}`)
+	if toolConfig := buildToolConfig(reqBody); toolConfig != nil {
+		t.Errorf("toolConfig = %+v, want nil without tools", toolConfig)
+	}
+}
+
+func TestProcessImageURLHTTPSOnly(t *testing.T) {
+	var fetches int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("png bytes"))
+	}))
+	defer server.Close()
+	imageURL := server.URL + "/cat.png"
+
+	if _, err := processImageURL(context.Background(), imageURL, true); err == nil {
+		t.Fatal("http image url accepted with https_only_images on")
+	}
+	if n := atomic.LoadInt32(&fetches); n != 0 {
+		t.Errorf("rejected image fetched %d times, want 0", n)
+	}
+
+	image, err := processImageURL(context.Background(), imageURL, false)
+	if err != nil {
+		t.Fatalf("processImageURL() with https_only_images off error = %v", err)
+	}
+	if image.Format != "png" || image.Source.Bytes != base64.StdEncoding.EncodeToString([]byte("png bytes")) {
+		t.Errorf("image = %+v, want the fetched png", image)
+	}
+
+	// Data URIs carry the image inline, https_only_images doesn't apply to them
+	dataURI := "data:image/webp;base64," + base64.StdEncoding.EncodeToString([]byte("webp bytes"))
+	if image, err := processImageURL(context.Background(), dataURI, true); err != nil || image.Format != "webp" {
+		t.Errorf("processImageURL(data uri) = %+v, %v, want a webp image", image, err)
+	}
+}
+
+func TestToolRoundTrip(t *testing.T) {
+	// Bedrock asks for two tools, the response is relayed in OpenAI's shape
+	var bedrockResp bedrock.Response
+	if err := json.Unmarshal([]byte(`{"output":{"message":{"role":"assistant","content":[`+
+		`{"text":"Checking both cities."},`+
+		`{"toolUse":{"toolUseId":"tooluse_paris","name":"get_weather","input":{"city":"Paris"}}},`+
+		`{"toolUse":{"toolUseId":"tooluse_rome","name":"get_weather","input":{"city":"Rome","unit":"celsius"}}}]}},`+
+		`"stopReason":"tool_use"}`), &bedrockResp); err != nil {
+		t.Fatal(err)
+	}
+	openAIResp, err := json.Marshal(createOpenAIResponse(newCompletion("bedrock/model"), bedrockResp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var relayed struct {
+		Choices []struct {
+			Message json.RawMessage `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(openAIResp, &relayed); err != nil || len(relayed.Choices) != 1 {
+		t.Fatalf("relayed response %s: %v", openAIResp, err)
+	}
+
+	// The client sends the assistant message back with the tool results
+	body := `{"model":"bedrock/model","tools":` + weatherTool + `,"messages":[` +
+		`{"role":"user","content":"Weather in Paris and Rome?"},` +
+		string(relayed.Choices[0].Message) + `,` +
+		`{"role":"tool","tool_call_id":"tooluse_paris","content":"sunny"},` +
+		`{"role":"tool","tool_call_id":"tooluse_rome","content":"rainy"}]}`
+	proxy := &BedrockProxy{BedrockEngine: &bedrock.BedrockEngine{}}
+	transformed, err := proxy.TransformChatCompletionRequest(context.Background(), parseRequest(t, body))
+	if err != nil {
+		t.Fatalf("TransformChatCompletionRequest() error = %v", err)
+	}
+	var converse bedrock.Request
+	if err := json.Unmarshal(transformed, &converse); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(converse.Messages) != 3 {
+		t.Fatalf("got %d converse messages, want user, assistant and one user message with both results: %s", len(converse.Messages), transformed)
+	}
+	assistant := converse.Messages[1]
+	if assistant.Role != "assistant" || len(assistant.Content) != 3 || assistant.Content[0].Text != "Checking both cities." {
+		t.Fatalf("assistant message = %+v, want the text and two toolUse blocks", assistant)
+	}
+	wantInputs := map[string]string{
+		"tooluse_paris": `{"city":"Paris"}`,
+		"tooluse_rome":  `{"city":"Rome","unit":"celsius"}`,
+	}
+	for _, block := range assistant.Content[1:] {
+		if block.ToolUse == nil || block.ToolUse.Name != "get_weather" {
+			t.Fatalf("block = %+v, want a get_weather toolUse", block)
+		}
+		var got, want map[string]interface{}
+		if err := json.Unmarshal(block.ToolUse.Input, &got); err != nil {
+			t.Fatal(err)
+		}
+		_ = json.Unmarshal([]byte(wantInputs[block.ToolUse.ToolUseId]), &want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("toolUse %s input = %s, want %s", block.ToolUse.ToolUseId, block.ToolUse.Input, wantInputs[block.ToolUse.ToolUseId])
+		}
+	}
+
+	results := converse.Messages[2]
+	if results.Role != "user" || len(results.Content) != 2 {
+		t.Fatalf("results message = %+v, want one user message with two toolResult blocks", results)
+	}
+	for i, want := range []struct{ id, text string }{{"tooluse_paris", "sunny"}, {"tooluse_rome", "rainy"}} {
+		result := results.Content[i].ToolResult
+		if result == nil || result.ToolUseId != want.id || len(result.Content) != 1 || result.Content[0].Text != want.text {
+			t.Errorf("toolResult %d = %+v, want %s answering %s", i, result, want.text, want.id)
+		}
+	}
+	if converse.ToolConfig == nil || len(converse.ToolConfig.Tools) != 1 {
+		t.Errorf("toolConfig = %+v, want the tools kept for the tool conversation", converse.ToolConfig)
+	}
+}
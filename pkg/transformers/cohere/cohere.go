@@ -0,0 +1,82 @@
+package cohere
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/robertprast/goop/pkg/openai_schema"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/robertprast/goop/pkg/engine/cohere"
+	"github.com/robertprast/goop/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// CohereProxy serves rerank requests from the Cohere API
+type CohereProxy struct {
+	*cohere.CohereEngine
+}
+
+// TransformRerankRequest strips the model prefix. Cohere's rerank request
+// already has the normalized shape.
+func (e *CohereProxy) TransformRerankRequest(ctx context.Context, reqBody openai_schema.RerankRequest) ([]byte, error) {
+	reqBody.Model = strings.TrimPrefix(reqBody.Model, "cohere/")
+	return json.Marshal(reqBody)
+}
+
+// HandleRerankRequest sends the rerank request to Cohere's /v2/rerank endpoint
+func (e *CohereProxy) HandleRerankRequest(ctx context.Context, model string, transformedBody []byte) (*http.Response, error) {
+	endpoint := e.Backend.String() + "/v2/rerank"
+	logrus.Infof("Cohere endpoint: %s", endpoint)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(transformedBody))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+e.APIKey)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making HTTP request: %w", err)
+	}
+	return resp, nil
+}
+
+// SendRerankResponse writes the normalized rerank results, dropping Cohere's
+// metadata. Errors are relayed as OpenAI style errors with the upstream status.
+func (e *CohereProxy) SendRerankResponse(ctx context.Context, resp *http.Response, w http.ResponseWriter) error {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(resp.Body)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading Cohere response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var cohereErr struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(body, &cohereErr); err != nil || cohereErr.Message == "" {
+			cohereErr.Message = strings.TrimSpace(string(body))
+		}
+		logrus.Errorf("Cohere returned %s: %s", resp.Status, cohereErr.Message)
+		utils.WriteOpenAIError(w, resp.StatusCode, utils.ErrTypeAPI, "upstream_error", cohereErr.Message)
+		return nil
+	}
+
+	var rerankResp openai_schema.RerankResponse
+	if err := json.Unmarshal(body, &rerankResp); err != nil {
+		return fmt.Errorf("error decoding Cohere rerank response: %w", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(rerankResp)
+}
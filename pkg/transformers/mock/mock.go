@@ -0,0 +1,160 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/robertprast/goop/pkg/openai_schema"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/robertprast/goop/pkg/engine/mock"
+	"github.com/robertprast/goop/pkg/transformers/openai"
+)
+
+// MockProxy answers chat completions locally. The reply is the engine's
+// canned response, or the last user message echoed back.
+type MockProxy struct {
+	*mock.MockEngine
+	*openai.OpenAIProxy
+}
+
+// NewMockProxy creates the chat completions proxy for a mock engine
+func NewMockProxy(e *mock.MockEngine) *MockProxy {
+	return &MockProxy{
+		MockEngine:  e,
+		OpenAIProxy: openai.NewOpenAIProxy("mock", "", "", ""),
+	}
+}
+
+// HandleChatCompletionRequest builds the response the upstream would have sent,
+// as JSON or as an SSE stream ending with [DONE]
+func (e *MockProxy) HandleChatCompletionRequest(ctx context.Context, model string, stream bool, transformedBody []byte) (*http.Response, error) {
+	var reqBody openai_schema.IncomingChatCompletionRequest
+	if err := json.Unmarshal(transformedBody, &reqBody); err != nil {
+		return nil, fmt.Errorf("error parsing request: %w", err)
+	}
+	reply := e.Response
+	if reply == "" {
+		reply = lastUserMessage(reqBody.Messages)
+	}
+
+	var body []byte
+	var err error
+	contentType := "application/json"
+	if stream {
+		contentType = "text/event-stream"
+		body, err = streamBody(model, reply)
+	} else {
+		body, err = json.Marshal(completion(model, reply, reqBody.Messages))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {contentType}},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+	}, nil
+}
+
+// lastUserMessage returns the text of the last user message
+func lastUserMessage(messages []openai_schema.ChatMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if msg.Role != "user" {
+			continue
+		}
+		if msg.Content != nil {
+			return *msg.Content
+		}
+		var text []string
+		for _, part := range msg.ContentParts {
+			if part.Type == "text" {
+				text = append(text, part.Text)
+			}
+		}
+		return strings.Join(text, "\n")
+	}
+	return ""
+}
+
+func completion(model, reply string, messages []openai_schema.ChatMessage) map[string]interface{} {
+	promptTokens := 0
+	for _, msg := range messages {
+		if msg.Content != nil {
+			promptTokens += len(strings.Fields(*msg.Content))
+		}
+	}
+	completionTokens := len(strings.Fields(reply))
+
+	return map[string]interface{}{
+		"id":      "chatcmpl-mock",
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   model,
+		"choices": []map[string]interface{}{
+			{
+				"index": 0,
+				"message": map[string]interface{}{
+					"role":    "assistant",
+					"content": reply,
+				},
+				"finish_reason": "stop",
+			},
+		},
+		"usage": map[string]interface{}{
+			"prompt_tokens":     promptTokens,
+			"completion_tokens": completionTokens,
+			"total_tokens":      promptTokens + completionTokens,
+		},
+	}
+}
+
+// streamBody splits reply into one chunk per word
+func streamBody(model, reply string) ([]byte, error) {
+	var buf bytes.Buffer
+	created := time.Now().Unix()
+	writeChunk := func(delta map[string]interface{}, finishReason interface{}) error {
+		chunk, err := json.Marshal(map[string]interface{}{
+			"id":      "chatcmpl-mock",
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   model,
+			"choices": []map[string]interface{}{
+				{
+					"index":         0,
+					"delta":         delta,
+					"finish_reason": finishReason,
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, "data: %s\n\n", chunk)
+		return nil
+	}
+
+	if err := writeChunk(map[string]interface{}{"role": "assistant", "content": ""}, nil); err != nil {
+		return nil, err
+	}
+	for _, word := range strings.SplitAfter(reply, " ") {
+		if word == "" {
+			continue
+		}
+		if err := writeChunk(map[string]interface{}{"content": word}, nil); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeChunk(map[string]interface{}{}, "stop"); err != nil {
+		return nil, err
+	}
+	buf.WriteString("data: [DONE]\n\n")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,36 @@
+package ollama
+
+import (
+	"context"
+	"github.com/robertprast/goop/pkg/openai_schema"
+
+	"github.com/robertprast/goop/pkg/engine/ollama"
+	"github.com/robertprast/goop/pkg/transformers/openai"
+)
+
+// OllamaProxy serves chat completions through Ollama's OpenAI compatible
+// endpoint using the generic OpenAI passthrough.
+type OllamaProxy struct {
+	*ollama.OllamaEngine
+	*openai.OpenAIProxy
+}
+
+// NewOllamaProxy creates the chat completions proxy for an Ollama engine
+func NewOllamaProxy(e *ollama.OllamaEngine) *OllamaProxy {
+	passthrough := openai.NewOpenAIProxy("ollama", "ollama/", e.Backend.String()+"/v1/chat/completions", "")
+	passthrough.StreamIdleTimeout = e.StreamIdleTimeout
+	passthrough.StreamFlushBytes = e.StreamFlushBytes
+	passthrough.StreamFlushInterval = e.StreamFlushInterval
+	return &OllamaProxy{
+		OllamaEngine: e,
+		OpenAIProxy:  passthrough,
+	}
+}
+
+// TransformChatCompletionRequest sends the output token limit as max_tokens,
+// which Ollama's OpenAI compatible endpoint reads
+func (e *OllamaProxy) TransformChatCompletionRequest(ctx context.Context, reqBody openai_schema.IncomingChatCompletionRequest) ([]byte, error) {
+	reqBody.MaxTokens = reqBody.OutputTokenLimit()
+	reqBody.MaxCompletionTokens = nil
+	return e.OpenAIProxy.TransformChatCompletionRequest(ctx, reqBody)
+}
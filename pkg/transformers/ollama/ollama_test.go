@@ -0,0 +1,56 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/robertprast/goop/pkg/engine/ollama"
+	"github.com/robertprast/goop/pkg/openai_schema"
+)
+
+func TestTransformChatCompletionRequestTokenLimit(t *testing.T) {
+	eng, err := ollama.NewOllamaEngine("base_url: http://localhost:11434")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := NewOllamaProxy(eng)
+
+	tests := []struct {
+		name   string
+		fields string
+		// want is the max_tokens sent to Ollama, nil when omitted
+		want interface{}
+	}{
+		{"neither", `"stream":false`, nil},
+		{"max_tokens", `"max_tokens":100`, float64(100)},
+		{"max_completion_tokens is sent as max_tokens", `"max_completion_tokens":200`, float64(200)},
+		{"max_completion_tokens wins", `"max_tokens":100,"max_completion_tokens":200`, float64(200)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reqBody openai_schema.IncomingChatCompletionRequest
+			body := `{"model":"ollama/llama3","messages":[{"role":"user","content":"hi"}],` + tt.fields + `}`
+			if err := json.Unmarshal([]byte(body), &reqBody); err != nil {
+				t.Fatal(err)
+			}
+			transformed, err := proxy.TransformChatCompletionRequest(context.Background(), reqBody)
+			if err != nil {
+				t.Fatalf("TransformChatCompletionRequest() error = %v", err)
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(transformed, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got["max_tokens"] != tt.want {
+				t.Errorf("max_tokens = %v, want %v", got["max_tokens"], tt.want)
+			}
+			if _, ok := got["max_completion_tokens"]; ok {
+				t.Errorf("max_completion_tokens = %v, want it omitted", got["max_completion_tokens"])
+			}
+			if got["model"] != "llama3" {
+				t.Errorf("model = %v, want llama3", got["model"])
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// errTranscriptionClosed stops a multipart rewrite whose output was closed early
+var errTranscriptionClosed = errors.New("transcription request closed")
+
+// multipartRewrite is the output of a multipart rewrite running in its own goroutine
+type multipartRewrite struct {
+	*io.PipeReader
+	done chan struct{}
+}
+
+// Close stops the rewrite and waits until it no longer reads the source body
+func (r *multipartRewrite) Close() error {
+	_ = r.PipeReader.CloseWithError(errTranscriptionClosed)
+	<-r.done
+	return nil
+}
+
+// TransformTranscriptionRequest streams a multipart transcription request,
+// stripping the model prefix from the model field. Parts are copied through a
+// pipe as they are read so the audio file is never held in memory. The
+// returned body must be closed before body is, closing waits for the copy.
+func (e *OpenAIProxy) TransformTranscriptionRequest(ctx context.Context, contentType string, body io.Reader) (io.ReadCloser, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return nil, errors.New("content type must be multipart/form-data with a boundary")
+	}
+	boundary := params["boundary"]
+
+	pr, pw := io.Pipe()
+	rewrite := &multipartRewrite{PipeReader: pr, done: make(chan struct{})}
+	go func() {
+		defer close(rewrite.done)
+		pw.CloseWithError(e.copyMultipart(multipart.NewReader(body, boundary), pw, boundary))
+	}()
+	return rewrite, nil
+}
+
+// copyMultipart copies each part from mr to dst unchanged apart from the model field
+func (e *OpenAIProxy) copyMultipart(mr *multipart.Reader, dst io.Writer, boundary string) error {
+	mw := multipart.NewWriter(dst)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+	for {
+		part, err := mr.NextRawPart()
+		if err == io.EOF {
+			return mw.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("error reading multipart body: %w", err)
+		}
+		out, err := mw.CreatePart(part.Header)
+		if err != nil {
+			return err
+		}
+		if part.FormName() == "model" {
+			model, err := io.ReadAll(io.LimitReader(part, 1024))
+			if err != nil {
+				return fmt.Errorf("error reading model field: %w", err)
+			}
+			_, err = io.WriteString(out, strings.TrimPrefix(string(model), e.modelPrefix))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := io.Copy(out, part); err != nil {
+			return err
+		}
+	}
+}
+
+// HandleTranscriptionRequest sends the multipart body to the backend's
+// transcription endpoint
+func (e *OpenAIProxy) HandleTranscriptionRequest(ctx context.Context, contentType string, body io.Reader) (*http.Response, error) {
+	return e.send(ctx, e.endpointFor("/audio/transcriptions"), contentType, body)
+}
@@ -0,0 +1,106 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowReader is a source that takes a while for every small read, like a client
+// uploading slowly, and reports whether a read is in progress
+type slowReader struct {
+	r       io.Reader
+	reading atomic.Bool
+	reads   atomic.Int64
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	s.reading.Store(true)
+	defer s.reading.Store(false)
+	s.reads.Add(1)
+	time.Sleep(5 * time.Millisecond)
+	if len(p) > 16 {
+		p = p[:16]
+	}
+	return s.r.Read(p)
+}
+
+func multipartBody(t *testing.T) (string, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	if err := mw.WriteField("model", "openai/whisper-1"); err != nil {
+		t.Fatal(err)
+	}
+	file, err := mw.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write(bytes.Repeat([]byte("a"), 64*1024)); err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return mw.FormDataContentType(), buf.Bytes()
+}
+
+func TestTransformTranscriptionRequestRewritesModel(t *testing.T) {
+	contentType, body := multipartBody(t)
+	proxy := NewOpenAIProxy("openai", "openai/", "", "")
+
+	transformed, err := proxy.TransformTranscriptionRequest(context.Background(), contentType, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transformed.Close()
+	out, err := io.ReadAll(transformed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	form, err := multipart.NewReader(bytes.NewReader(out), params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := form.Value["model"]; len(got) != 1 || got[0] != "whisper-1" {
+		t.Errorf("model = %v, want [whisper-1]", got)
+	}
+}
+
+func TestTransformTranscriptionRequestCloseWaitsForCopy(t *testing.T) {
+	contentType, body := multipartBody(t)
+	source := &slowReader{r: bytes.NewReader(body)}
+	proxy := NewOpenAIProxy("openai", "openai/", "", "")
+
+	transformed, err := proxy.TransformTranscriptionRequest(context.Background(), contentType, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Give up while the rewrite is still reading the source, as when the upstream fails early
+	time.Sleep(2 * time.Millisecond)
+	if err := transformed.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if source.reading.Load() {
+		t.Error("source is still being read after Close returned")
+	}
+	reads := source.reads.Load()
+	time.Sleep(20 * time.Millisecond)
+	if got := source.reads.Load(); got != reads {
+		t.Errorf("source was read %d more times after Close returned", got-reads)
+	}
+	if reads*16 >= int64(len(body)) {
+		t.Errorf("source was read to the end, the rewrite wasn't stopped")
+	}
+}
@@ -0,0 +1,70 @@
+package openai
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// flushWriter writes a stream to the client and flushes it once maxBytes are
+// pending or interval has passed since the first unflushed write. With neither
+// set every write is flushed immediately.
+type flushWriter struct {
+	mu       sync.Mutex
+	w        http.ResponseWriter
+	flusher  http.Flusher
+	maxBytes int
+	interval time.Duration
+
+	pending int
+	timer   *time.Timer
+	closed  bool
+}
+
+func newFlushWriter(w http.ResponseWriter, maxBytes int, interval time.Duration) *flushWriter {
+	flusher, _ := w.(http.Flusher)
+	return &flushWriter{w: w, flusher: flusher, maxBytes: maxBytes, interval: interval}
+}
+
+func (f *flushWriter) Write(b []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n, err := f.w.Write(b)
+	f.pending += n
+	switch {
+	case f.maxBytes <= 0 && f.interval <= 0, f.maxBytes > 0 && f.pending >= f.maxBytes:
+		f.flushLocked()
+	case f.interval > 0 && f.timer == nil:
+		f.timer = time.AfterFunc(f.interval, func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if !f.closed {
+				f.flushLocked()
+			}
+		})
+	}
+	return n, err
+}
+
+// Close flushes anything pending. Nothing is written or flushed afterwards.
+func (f *flushWriter) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return
+	}
+	f.flushLocked()
+	f.closed = true
+}
+
+func (f *flushWriter) flushLocked() {
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	if f.pending > 0 && f.flusher != nil {
+		f.flusher.Flush()
+	}
+	f.pending = 0
+}
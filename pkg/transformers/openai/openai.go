@@ -0,0 +1,209 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/robertprast/goop/pkg/openai_schema"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/robertprast/goop/pkg/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// OpenAIProxy passes chat completions through to an OpenAI compatible
+// backend. Only the model prefix is stripped from the request, the response
+// is copied back as is.
+type OpenAIProxy struct {
+	// StreamIdleTimeout aborts a stream when no data arrives within the window. Zero disables it.
+	StreamIdleTimeout time.Duration
+	// Transport sends the requests, http.DefaultTransport when nil
+	Transport http.RoundTripper
+	// StreamFlushBytes and StreamFlushInterval coalesce streamed writes, flushing once
+	// either is reached. With both zero every write is flushed.
+	StreamFlushBytes    int
+	StreamFlushInterval time.Duration
+
+	engineName  string
+	modelPrefix string
+	endpoint    string
+	apiKey      string
+}
+
+// NewOpenAIProxy creates a passthrough for endpoint. modelPrefix (e.g. "mistral/")
+// is stripped from the model name and apiKey is sent as a bearer token when set.
+func NewOpenAIProxy(engineName, modelPrefix, endpoint, apiKey string) *OpenAIProxy {
+	return &OpenAIProxy{
+		engineName:  engineName,
+		modelPrefix: modelPrefix,
+		endpoint:    endpoint,
+		apiKey:      apiKey,
+	}
+}
+
+func (e *OpenAIProxy) TransformChatCompletionRequest(ctx context.Context, reqBody openai_schema.IncomingChatCompletionRequest) ([]byte, error) {
+	reqBody.Model = strings.TrimPrefix(reqBody.Model, e.modelPrefix)
+	// Newer OpenAI models reject max_tokens, only send the limit that wins
+	if reqBody.MaxCompletionTokens != nil {
+		reqBody.MaxTokens = nil
+	}
+	return json.Marshal(reqBody)
+}
+
+func (e *OpenAIProxy) HandleChatCompletionRequest(ctx context.Context, model string, stream bool, transformedBody []byte) (*http.Response, error) {
+	return e.send(ctx, e.endpoint, "application/json", bytes.NewReader(transformedBody))
+}
+
+// send posts body to endpoint with the backend's credentials. Error
+// responses are buffered so they can be logged and still relayed.
+func (e *OpenAIProxy) send(ctx context.Context, endpoint, contentType string, body io.Reader) (*http.Response, error) {
+	logrus.Infof("%s endpoint: %s", e.engineName, endpoint)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	client := &http.Client{Transport: e.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making HTTP request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		logrus.Errorf("%s API error: Status %d, Body: %s", e.engineName, resp.StatusCode, string(body))
+		resp.Body = io.NopCloser(bytes.NewBuffer(body))
+	}
+
+	return resp, nil
+}
+
+// endpointFor returns the backend endpoint for path, a sibling of the chat
+// completions endpoint such as "/images/generations"
+func (e *OpenAIProxy) endpointFor(path string) string {
+	return strings.TrimSuffix(e.endpoint, "/chat/completions") + path
+}
+
+// SendChatCompletionResponse copies the upstream response to the client,
+// flushing as data arrives so streamed chunks aren't held back.
+func (e *OpenAIProxy) SendChatCompletionResponse(ctx context.Context, resp *http.Response, w http.ResponseWriter, stream bool) error {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+
+		}
+	}(resp.Body)
+	// Stop reading from the upstream as soon as the client goes away
+	stop := context.AfterFunc(ctx, func() { _ = resp.Body.Close() })
+	defer stop()
+
+	for _, header := range []string{"Content-Type", "Cache-Control"} {
+		if value := resp.Header.Get(header); value != "" {
+			w.Header().Set(header, value)
+		}
+	}
+	utils.CopyRateLimitHeaders(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+
+	if stream {
+		resp.Body = utils.NewIdleTimeoutReader(resp.Body, e.StreamIdleTimeout)
+	}
+	out := newFlushWriter(w, e.StreamFlushBytes, e.StreamFlushInterval)
+	defer out.Close()
+	buf := make([]byte, 4096)
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, writeErr := out.Write(buf[:n]); writeErr != nil {
+				return writeErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if errors.Is(err, utils.ErrIdleTimeout) {
+			out.Close()
+			logrus.Warnf("%s stream idle for %s, aborting", e.engineName, e.StreamIdleTimeout)
+			return utils.WriteStreamError(w, "timeout", fmt.Sprintf("upstream stream idle for %s", e.StreamIdleTimeout))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// TransformImageGenerationRequest sets the model of an image generation request
+// without its prefix. Other fields are forwarded as sent, including ones the
+// schema doesn't know such as background or output_format.
+func (e *OpenAIProxy) TransformImageGenerationRequest(ctx context.Context, body []byte, reqBody openai_schema.ImageGenerationRequest) ([]byte, error) {
+	return e.setModel(body, reqBody.Model)
+}
+
+// HandleImageGenerationRequest sends an image generation request to the backend
+func (e *OpenAIProxy) HandleImageGenerationRequest(ctx context.Context, model string, transformedBody []byte) (*http.Response, error) {
+	return e.send(ctx, e.endpointFor("/images/generations"), "application/json", bytes.NewReader(transformedBody))
+}
+
+// SendImageGenerationResponse copies the upstream response to the client
+func (e *OpenAIProxy) SendImageGenerationResponse(ctx context.Context, resp *http.Response, w http.ResponseWriter) error {
+	return e.SendChatCompletionResponse(ctx, resp, w, false)
+}
+
+// TransformModerationRequest strips the model prefix from a moderation
+// request. Other fields are forwarded as sent.
+func (e *OpenAIProxy) TransformModerationRequest(ctx context.Context, body []byte) ([]byte, error) {
+	var reqBody map[string]json.RawMessage
+	if err := json.Unmarshal(body, &reqBody); err != nil {
+		return nil, fmt.Errorf("error parsing request body: %w", err)
+	}
+	rawModel, ok := reqBody["model"]
+	if !ok {
+		return body, nil
+	}
+	var model string
+	if err := json.Unmarshal(rawModel, &model); err != nil {
+		return nil, fmt.Errorf("model must be a string: %w", err)
+	}
+	reqBody["model"], _ = json.Marshal(strings.TrimPrefix(model, e.modelPrefix))
+	return json.Marshal(reqBody)
+}
+
+// HandleModerationRequest sends a moderation request to the backend
+func (e *OpenAIProxy) HandleModerationRequest(ctx context.Context, transformedBody []byte) (*http.Response, error) {
+	return e.send(ctx, e.endpointFor("/moderations"), "application/json", bytes.NewReader(transformedBody))
+}
+
+// TransformResponsesRequest sets the model of a Responses API request to model
+// without its prefix. Other fields are forwarded as sent.
+func (e *OpenAIProxy) TransformResponsesRequest(ctx context.Context, body []byte, model string) ([]byte, error) {
+	return e.setModel(body, model)
+}
+
+// setModel replaces the model of a JSON request body with model without its
+// prefix, leaving every other field as sent
+func (e *OpenAIProxy) setModel(body []byte, model string) ([]byte, error) {
+	var reqBody map[string]json.RawMessage
+	if err := json.Unmarshal(body, &reqBody); err != nil {
+		return nil, fmt.Errorf("error parsing request body: %w", err)
+	}
+	reqBody["model"], _ = json.Marshal(strings.TrimPrefix(model, e.modelPrefix))
+	return json.Marshal(reqBody)
+}
+
+// HandleResponsesRequest sends a Responses API request to the backend
+func (e *OpenAIProxy) HandleResponsesRequest(ctx context.Context, transformedBody []byte) (*http.Response, error) {
+	return e.send(ctx, e.endpointFor("/responses"), "application/json", bytes.NewReader(transformedBody))
+}
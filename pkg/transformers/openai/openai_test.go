@@ -0,0 +1,140 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/robertprast/goop/pkg/openai_schema"
+)
+
+func TestTransformImageGenerationRequestKeepsUnknownFields(t *testing.T) {
+	body := []byte(`{"model":"openai/gpt-image-1","prompt":"a cat","n":2,"background":"transparent","output_format":"webp","moderation":"low","output_compression":80}`)
+	var reqBody openai_schema.ImageGenerationRequest
+	if err := json.Unmarshal(body, &reqBody); err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := NewOpenAIProxy("openai", "openai/", "", "")
+	transformed, err := proxy.TransformImageGenerationRequest(context.Background(), body, reqBody)
+	if err != nil {
+		t.Fatalf("TransformImageGenerationRequest() error = %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(transformed, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"model":              "gpt-image-1",
+		"prompt":             "a cat",
+		"n":                  float64(2),
+		"background":         "transparent",
+		"output_format":      "webp",
+		"moderation":         "low",
+		"output_compression": float64(80),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("transformed = %v, want %v", got, want)
+	}
+}
+
+// transformChat parses body and runs it through the passthrough's request transform
+func transformChat(t *testing.T, body string) map[string]interface{} {
+	t.Helper()
+	var reqBody openai_schema.IncomingChatCompletionRequest
+	if err := json.Unmarshal([]byte(body), &reqBody); err != nil {
+		t.Fatal(err)
+	}
+	proxy := NewOpenAIProxy("openai", "openai/", "", "")
+	transformed, err := proxy.TransformChatCompletionRequest(context.Background(), reqBody)
+	if err != nil {
+		t.Fatalf("TransformChatCompletionRequest() error = %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(transformed, &got); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestTransformChatCompletionRequestToolChoice(t *testing.T) {
+	const tools = `[{"type":"function","function":{"name":"get_weather","parameters":{"type":"object"}}}]`
+	userTurn := `[{"role":"user","content":"Weather in Paris?"}]`
+	toolTurn := `[{"role":"user","content":"Weather in Paris?"},` +
+		`{"role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{}"}}]},` +
+		`{"role":"tool","tool_call_id":"call_1","content":"sunny"}]`
+
+	tests := []struct {
+		name       string
+		messages   string
+		toolChoice string
+		want       interface{}
+	}{
+		{"auto", userTurn, `"auto"`, "auto"},
+		{"none", userTurn, `"none"`, "none"},
+		{"required", userTurn, `"required"`, "required"},
+		{"function", userTurn, `{"type":"function","function":{"name":"get_weather"}}`,
+			map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "get_weather"}}},
+		// OpenAI enforces none itself, unlike Bedrock there's no fallback to auto
+		{"none with tool use", toolTurn, `"none"`, "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := transformChat(t, `{"model":"openai/gpt-4o","messages":`+tt.messages+`,"tools":`+tools+`,"tool_choice":`+tt.toolChoice+`}`)
+			if !reflect.DeepEqual(got["tool_choice"], tt.want) {
+				t.Errorf("tool_choice = %v, want %v", got["tool_choice"], tt.want)
+			}
+			if tools, _ := got["tools"].([]interface{}); len(tools) != 1 {
+				t.Errorf("tools = %v, want the get_weather tool", got["tools"])
+			}
+		})
+	}
+}
+
+func TestTransformChatCompletionRequestKeepsStrict(t *testing.T) {
+	body := `{"model":"openai/gpt-4o","messages":[{"role":"user","content":"hi"}],"tools":[` +
+		`{"type":"function","function":{"name":"strict_tool","strict":true,"parameters":{"type":"object","properties":{},"additionalProperties":false}}},` +
+		`{"type":"function","function":{"name":"lax_tool","strict":false,"parameters":{"type":"object"}}},` +
+		`{"type":"function","function":{"name":"plain_tool","parameters":{"type":"object"}}}]}`
+	got := transformChat(t, body)
+
+	tools, _ := got["tools"].([]interface{})
+	if len(tools) != 3 {
+		t.Fatalf("tools = %v, want 3 tools", got["tools"])
+	}
+	want := []interface{}{true, false, nil}
+	for i, tool := range tools {
+		function, _ := tool.(map[string]interface{})["function"].(map[string]interface{})
+		if strict := function["strict"]; strict != want[i] {
+			t.Errorf("tool %v strict = %v, want %v", function["name"], strict, want[i])
+		}
+	}
+}
+
+func TestTransformChatCompletionRequestTokenLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields string
+		// wantMaxTokens and wantMaxCompletionTokens are nil when the field is omitted
+		wantMaxTokens           interface{}
+		wantMaxCompletionTokens interface{}
+	}{
+		{"neither", `"stream":false`, nil, nil},
+		{"max_tokens", `"max_tokens":100`, float64(100), nil},
+		{"max_completion_tokens", `"max_completion_tokens":200`, nil, float64(200)},
+		{"max_completion_tokens wins", `"max_tokens":100,"max_completion_tokens":200`, nil, float64(200)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := transformChat(t, `{"model":"openai/gpt-4o","messages":[{"role":"user","content":"hi"}],`+tt.fields+`}`)
+			if got["max_tokens"] != tt.wantMaxTokens {
+				t.Errorf("max_tokens = %v, want %v", got["max_tokens"], tt.wantMaxTokens)
+			}
+			if got["max_completion_tokens"] != tt.wantMaxCompletionTokens {
+				t.Errorf("max_completion_tokens = %v, want %v", got["max_completion_tokens"], tt.wantMaxCompletionTokens)
+			}
+		})
+	}
+}
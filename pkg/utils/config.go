@@ -1,31 +1,197 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
 
 type Config struct {
-	Engines map[string]string `yaml:"engines"`
+	Engines map[string]string `yaml:"-"`
+	Server  ServerConfig      `yaml:"server"`
+	Metrics MetricsConfig     `yaml:"metrics"`
+	Audit   AuditConfig       `yaml:"audit"`
+	Auth    AuthConfig        `yaml:"auth"`
+	Request RequestConfig     `yaml:"request"`
+
+	DeadLetter     DeadLetterConfig     `yaml:"dead_letter"`
+	DegradedMode   DegradedModeConfig   `yaml:"degraded_mode"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	Concurrency    ConcurrencyConfig    `yaml:"concurrency"`
+	Routing        RoutingConfig        `yaml:"routing"`
+	Tokenizer      TokenizerConfig      `yaml:"tokenizer"`
+
+	// ModelsCacheTTL is how long engine model lists are reused, defaults to 5 minutes
+	ModelsCacheTTL time.Duration `yaml:"models_cache_ttl"`
+}
+
+// ServerConfig holds HTTP server settings
+type ServerConfig struct {
+	CORS CORSConfig `yaml:"cors"`
+	// MaxHeaderBytes caps the total request header size, defaults to net/http's 1MB
+	MaxHeaderBytes int `yaml:"max_header_bytes"`
+	// MaxHeaderCount caps the number of request header values, unlimited when 0
+	MaxHeaderCount int `yaml:"max_header_count"`
+	// MaxRequestBytes caps request bodies, larger requests get a 413. Defaults to 10MB.
+	MaxRequestBytes int64 `yaml:"max_request_bytes"`
+	// RequestTimeout bounds a whole chat completion request (transform, image fetches, upstream call and response), unlimited when 0
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+}
+
+// CORSConfig controls cross-origin access. CORS headers are only sent when AllowedOrigins is set.
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	AllowedMethods []string `yaml:"allowed_methods"`
+	AllowedHeaders []string `yaml:"allowed_headers"`
+}
+
+// MetricsConfig holds optional settings for the Prometheus metrics
+type MetricsConfig struct {
+	// MetadataLabels is the allowlist of request `metadata` keys promoted to metric labels
+	MetadataLabels []string `yaml:"metadata_labels"`
 }
 
-// LoadConfig reads the config file, substitutes environment variables, and converts engine configs to strings
+// AuditConfig selects where audited requests and responses are persisted
+type AuditConfig struct {
+	// Enabled turns auditing off when false, defaults to true
+	Enabled *bool `yaml:"enabled"`
+	// SampleRate is the fraction (0-1) of requests audited, defaults to 1
+	SampleRate *float64 `yaml:"sample_rate"`
+	// Sink is either "logrus" (default) or "postgres"
+	Sink        string `yaml:"sink"`
+	PostgresDSN string `yaml:"postgres_dsn"`
+	// MaxBodyBytes caps the captured body size, larger bodies are truncated in the audit log only
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+	// StreamCapturePath, when set, appends every streamed chat completion chunk to this JSON lines file
+	StreamCapturePath string `yaml:"stream_capture_path"`
+	// StreamCaptureBuffer is the number of chunks queued for the capture file before chunks are dropped
+	StreamCaptureBuffer int `yaml:"stream_capture_buffer"`
+	// RedactPatterns are masked in audited and captured bodies, "email", "phone" or regular expressions
+	RedactPatterns []string `yaml:"redact_patterns"`
+}
+
+// AuthConfig holds per-caller request limits
+type AuthConfig struct {
+	// RateLimitByUser limits requests per API key and request `user`, so a shared key stays fair across end users
+	RateLimitByUser       bool `yaml:"rate_limit_by_user"`
+	UserRequestsPerMinute int  `yaml:"user_requests_per_minute"`
+}
+
+// RequestConfig controls how incoming chat completion requests are normalized
+type RequestConfig struct {
+	// CollapseSingleTextContent rewrites `content: [{type: text, text: ...}]` to a plain string
+	CollapseSingleTextContent bool `yaml:"collapse_single_text_content"`
+	// ValidateModels rejects models missing from the engine's model list with a 404 before routing
+	ValidateModels bool `yaml:"validate_models"`
+	// DefaultEngine routes models without a known engine prefix, e.g. "gpt-4o" -> "openai/gpt-4o"
+	DefaultEngine string `yaml:"default_engine"`
+	// MaxTokensCap limits max_tokens and max_completion_tokens, and sets max_tokens when neither is sent. Zero disables it.
+	MaxTokensCap int `yaml:"max_tokens_cap"`
+	// SystemPromptPrefix is put ahead of every request's system prompt
+	SystemPromptPrefix string `yaml:"system_prompt_prefix"`
+	// SystemPromptPrefixByModel overrides SystemPromptPrefix per model (e.g. "bedrock/..."), an empty value disables it
+	SystemPromptPrefixByModel map[string]string `yaml:"system_prompt_prefix_by_model"`
+}
+
+// DeadLetterConfig enables logging failed upstream requests (5xx, timeouts) for replay
+type DeadLetterConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Path is the JSON lines file entries are appended to, defaults to dead_letter.jsonl
+	Path string `yaml:"path"`
+}
+
+// DegradedModeConfig enables a static assistant reply when every engine's circuit breaker is open
+type DegradedModeConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Message string `yaml:"message"`
+}
+
+// CircuitBreakerConfig stops sending requests to an engine whose upstream keeps failing
+type CircuitBreakerConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// ErrorRatio of failed requests (errors and 5xx) within Window that opens the breaker, defaults to 0.5.
+	// Requests the client cancelled or that hit their own deadline are not counted.
+	ErrorRatio float64 `yaml:"error_ratio"`
+	// MinRequests within Window before the ratio is considered, defaults to 10
+	MinRequests int `yaml:"min_requests"`
+	// Window is the period requests are counted over, defaults to 1 minute
+	Window time.Duration `yaml:"window"`
+	// Cooldown is how long the breaker stays open before a probe request is let through, defaults to 30 seconds
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+// ConcurrencyConfig bounds simultaneous upstream requests per engine
+type ConcurrencyConfig struct {
+	// MaxConcurrent maps an engine name to its in-flight request limit, engines not listed are unlimited
+	MaxConcurrent map[string]int `yaml:"max_concurrent"`
+	// QueueTimeout is how long a request over the limit waits for a slot before a 429, zero rejects immediately
+	QueueTimeout time.Duration `yaml:"queue_timeout"`
+}
+
+// RoutingConfig rewrites the requested model by estimated prompt size
+type RoutingConfig struct {
+	// Rules are tried in order, the first matching rule picks the model
+	Rules []RoutingRule `yaml:"rules"`
+}
+
+// RoutingRule routes requests for Model to Target when the prompt is small enough
+type RoutingRule struct {
+	// Model is the requested model the rule applies to, e.g. an alias like "auto"
+	Model string `yaml:"model"`
+	// MaxPromptTokens is the largest estimated prompt the rule matches, zero matches any size
+	MaxPromptTokens int    `yaml:"max_prompt_tokens"`
+	Target          string `yaml:"target"`
+}
+
+// TokenizerConfig points to the tiktoken rank files used to count OpenAI model tokens
+type TokenizerConfig struct {
+	// Encodings maps an encoding name (cl100k_base, o200k_base) to its .tiktoken file.
+	// Models without a loaded encoding get estimated counts.
+	Encodings map[string]string `yaml:"encodings"`
+}
+
+// LoadConfig reads the config file, substitutes environment variables, and converts engine configs to strings.
+// When the file doesn't exist the config is built from environment variables instead.
 func LoadConfig(filename string) (Config, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		logrus.Warnf("Config file %s not found, loading configuration from environment", filename)
+		data, err = configFromEnv()
+		if err != nil {
+			return Config{}, err
+		}
+		return parseConfig(string(data))
+	}
+	if err != nil {
+		return Config{}, err
+	}
+
+	substitutedData, err := substituteEnvVars(string(data))
+	if err != nil {
+		return Config{}, err
+	}
+	return parseConfig(substitutedData)
+}
+
+// parseConfig parses a YAML config document into a Config
+func parseConfig(substitutedData string) (Config, error) {
 	var rawConfig map[string]interface{}
 	var finalConfig Config
 
-	data, err := os.ReadFile(filename)
+	err := yaml.Unmarshal([]byte(substitutedData), &rawConfig)
 	if err != nil {
-		return finalConfig, err
+		return finalConfig, fmt.Errorf("error parsing YAML: %w", err)
 	}
 
-	substitutedData := substituteEnvVars(string(data))
-
-	err = yaml.Unmarshal([]byte(substitutedData), &rawConfig)
+	// Engine configs are kept as raw YAML for each engine to parse, every other
+	// top level section is decoded straight into the typed config
+	err = yaml.Unmarshal([]byte(substitutedData), &finalConfig)
 	if err != nil {
 		return finalConfig, fmt.Errorf("error parsing YAML: %w", err)
 	}
@@ -49,10 +215,61 @@ func LoadConfig(filename string) (Config, error) {
 	return finalConfig, nil
 }
 
+// configFromEnv builds a YAML config document from environment variables, for
+// deployments that don't ship a config file. An engine is only enabled when its
+// variables are set:
+//
+//	OPENAI_API_KEY, OPENAI_BASE_URL (default https://api.openai.com/v1)
+//	AZURE_OPENAI_API_KEY, AZURE_OPENAI_BASE_URL, AZURE_OPENAI_API_VERSION
+//	BEDROCK_ENABLED=true, AWS_REGION
+//	VERTEX_ENABLED=true
+//	AUDIT_SINK, AUDIT_POSTGRES_DSN
+func configFromEnv() ([]byte, error) {
+	engines := map[string]interface{}{}
+
+	if apiKey := os.Getenv("OPENAI_API_KEY"); apiKey != "" {
+		engines["openai"] = map[string]string{
+			"api_key":  apiKey,
+			"base_url": GetEnv("OPENAI_BASE_URL", "https://api.openai.com/v1"),
+		}
+	}
+	if apiKey := os.Getenv("AZURE_OPENAI_API_KEY"); apiKey != "" {
+		engines["azure"] = []map[string]string{{
+			"api_key":     apiKey,
+			"base_url":    os.Getenv("AZURE_OPENAI_BASE_URL"),
+			"api_version": os.Getenv("AZURE_OPENAI_API_VERSION"),
+		}}
+	}
+	if GetEnv("BEDROCK_ENABLED", "false") == "true" {
+		engines["bedrock"] = map[string]interface{}{
+			"enabled": true,
+			"region":  os.Getenv("AWS_REGION"),
+		}
+	}
+	if GetEnv("VERTEX_ENABLED", "false") == "true" {
+		engines["vertex"] = map[string]interface{}{
+			"enabled": true,
+		}
+	}
+
+	data, err := yaml.Marshal(map[string]interface{}{
+		"engines": engines,
+		"audit": map[string]string{
+			"sink":         os.Getenv("AUDIT_SINK"),
+			"postgres_dsn": os.Getenv("AUDIT_POSTGRES_DSN"),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error building config from environment: %w", err)
+	}
+	return data, nil
+}
+
 // substituteEnvVars replaces ${VAR} with the environment variable value
-func substituteEnvVars(content string) string {
+func substituteEnvVars(content string) (string, error) {
+	var missing []string
 	re := regexp.MustCompile(`\$\{(\w+)\}`)
-	return re.ReplaceAllStringFunc(content, func(match string) string {
+	substituted := re.ReplaceAllStringFunc(content, func(match string) string {
 		// check that match len is at least 4 to avoid out of bounds error
 		if len(match) < 4 {
 			return match
@@ -60,8 +277,12 @@ func substituteEnvVars(content string) string {
 		envVar := match[2 : len(match)-1] // Extract variable name
 		value := os.Getenv(envVar)
 		if value == "" {
-			logrus.Fatalf("Warning: environment variable %s is not set\n", envVar)
+			missing = append(missing, envVar)
 		}
 		return value
 	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variables not set: %s", strings.Join(missing, ", "))
+	}
+	return substituted, nil
 }
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// clearConfigEnv unsets every variable configFromEnv reads
+func clearConfigEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{
+		"OPENAI_API_KEY", "OPENAI_BASE_URL",
+		"AZURE_OPENAI_API_KEY", "AZURE_OPENAI_BASE_URL", "AZURE_OPENAI_API_VERSION",
+		"BEDROCK_ENABLED", "AWS_REGION", "VERTEX_ENABLED",
+		"AUDIT_SINK", "AUDIT_POSTGRES_DSN",
+	} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestLoadConfigWithoutFile(t *testing.T) {
+	clearConfigEnv(t)
+	missing := filepath.Join(t.TempDir(), "config.yml")
+
+	config, err := LoadConfig(missing)
+	if err != nil {
+		t.Fatalf("LoadConfig() without a config file error = %v", err)
+	}
+	if len(config.Engines) != 0 {
+		t.Errorf("engines = %v, want none without environment variables", config.Engines)
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("BEDROCK_ENABLED", "true")
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AUDIT_SINK", "logrus")
+
+	config, err := LoadConfig(filepath.Join(t.TempDir(), "config.yml"))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if len(config.Engines) != 2 {
+		t.Errorf("engines = %v, want openai and bedrock", config.Engines)
+	}
+	openai := config.Engines["openai"]
+	if !strings.Contains(openai, "api_key: sk-test") || !strings.Contains(openai, "base_url: https://api.openai.com/v1") {
+		t.Errorf("openai config = %q, want the key and the default base url", openai)
+	}
+	bedrock := config.Engines["bedrock"]
+	if !strings.Contains(bedrock, "enabled: true") || !strings.Contains(bedrock, "region: eu-west-1") {
+		t.Errorf("bedrock config = %q, want it enabled in eu-west-1", bedrock)
+	}
+	if config.Audit.Sink != "logrus" {
+		t.Errorf("audit sink = %q, want logrus", config.Audit.Sink)
+	}
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// OpenAI error types used in error envelopes
+const (
+	ErrTypeInvalidRequest = "invalid_request_error"
+	ErrTypeAPI            = "api_error"
+	ErrTypeRateLimit      = "rate_limit_error"
+)
+
+// openAIError is the body OpenAI SDKs expect for non-2xx responses
+type openAIError struct {
+	Error openAIErrorDetail `json:"error"`
+}
+
+type openAIErrorDetail struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
+
+// WriteOpenAIError writes an OpenAI format error envelope with the given status.
+// An empty code is sent as null.
+func WriteOpenAIError(w http.ResponseWriter, status int, errType, code, message string) {
+	detail := openAIErrorDetail{
+		Message: message,
+		Type:    errType,
+	}
+	if code != "" {
+		detail.Code = &code
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(openAIError{Error: detail}); err != nil {
+		logrus.Errorf("Error writing error response: %v", err)
+	}
+}
+
+// WriteStreamError ends an SSE stream with an OpenAI style error event
+func WriteStreamError(w http.ResponseWriter, errType, message string) error {
+	errJSON, err := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    errType,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "data: %s\n\n", errJSON); err != nil {
+		return err
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
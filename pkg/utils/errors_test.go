@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteOpenAIError(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want string
+	}{
+		{name: "with code", code: "upstream_error", want: `{"error":{"message":"boom","type":"api_error","param":null,"code":"upstream_error"}}` + "\n"},
+		{name: "empty code is null", want: `{"error":{"message":"boom","type":"api_error","param":null,"code":null}}` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			WriteOpenAIError(rec, http.StatusBadGateway, ErrTypeAPI, tt.code, "boom")
+			if rec.Code != http.StatusBadGateway {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadGateway)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q", got)
+			}
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("body = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
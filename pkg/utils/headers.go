@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CopyRateLimitHeaders copies the upstream's Retry-After and rate limit headers
+// (x-ratelimit-*, anthropic-ratelimit-*) to a response built by the proxy
+func CopyRateLimitHeaders(dst, src http.Header) {
+	for name, values := range src {
+		lower := strings.ToLower(name)
+		if lower == "retry-after" || lower == "retry-after-ms" ||
+			strings.HasPrefix(lower, "x-ratelimit-") || strings.HasPrefix(lower, "anthropic-ratelimit-") {
+			dst[name] = append([]string(nil), values...)
+		}
+	}
+}
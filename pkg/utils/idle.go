@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ErrIdleTimeout is returned by an idle timeout reader once no data arrived within its window
+var ErrIdleTimeout = errors.New("stream idle timeout")
+
+type idleTimeoutReader struct {
+	rc       io.ReadCloser
+	timeout  time.Duration
+	timer    *time.Timer
+	timedOut atomic.Bool
+}
+
+// NewIdleTimeoutReader wraps rc so that a Read blocked for longer than timeout
+// without receiving data closes rc and fails with ErrIdleTimeout. Only time
+// spent inside Read counts, a caller slow to write out what it read doesn't
+// trip the timeout. A timeout of 0 returns rc unchanged.
+func NewIdleTimeoutReader(rc io.ReadCloser, timeout time.Duration) io.ReadCloser {
+	if timeout <= 0 {
+		return rc
+	}
+	r := &idleTimeoutReader{rc: rc, timeout: timeout}
+	r.timer = time.AfterFunc(timeout, func() {
+		_ = rc.Close()
+	})
+	r.timer.Stop()
+	return r
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	if r.timedOut.Load() {
+		return 0, ErrIdleTimeout
+	}
+	r.timer.Reset(r.timeout)
+	n, err := r.rc.Read(p)
+	// Stop fails only when the timer already fired and closed rc
+	if !r.timer.Stop() {
+		r.timedOut.Store(true)
+		return n, ErrIdleTimeout
+	}
+	return n, err
+}
+
+func (r *idleTimeoutReader) Close() error {
+	r.timer.Stop()
+	return r.rc.Close()
+}
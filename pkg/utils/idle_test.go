@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestIdleTimeoutReaderBlockedRead(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	r := NewIdleTimeoutReader(pr, 20*time.Millisecond)
+
+	start := time.Now()
+	_, err := r.Read(make([]byte, 8))
+	if !errors.Is(err, ErrIdleTimeout) {
+		t.Fatalf("Read() error = %v, want ErrIdleTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Read() returned after %s", elapsed)
+	}
+	if _, err := r.Read(make([]byte, 8)); !errors.Is(err, ErrIdleTimeout) {
+		t.Errorf("Read() after timeout error = %v, want ErrIdleTimeout", err)
+	}
+}
+
+func TestIdleTimeoutReaderSlowConsumer(t *testing.T) {
+	pr, pw := io.Pipe()
+	go func() {
+		for i := 0; i < 3; i++ {
+			_, _ = pw.Write([]byte("chunk"))
+		}
+		_ = pw.Close()
+	}()
+	r := NewIdleTimeoutReader(pr, 20*time.Millisecond)
+	defer r.Close()
+
+	// Time spent between reads, e.g. writing to a slow client, isn't idle upstream time
+	for i := 0; i < 3; i++ {
+		if _, err := r.Read(make([]byte, 8)); err != nil {
+			t.Fatalf("Read() %d error = %v", i, err)
+		}
+		time.Sleep(40 * time.Millisecond)
+	}
+	if _, err := r.Read(make([]byte, 8)); err != io.EOF {
+		t.Errorf("Read() at end error = %v, want io.EOF", err)
+	}
+}
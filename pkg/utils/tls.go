@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// TLSConfig holds optional TLS settings for backends behind a private CA or mTLS
+type TLSConfig struct {
+	// CACert is a PEM file of CAs trusted in addition to the system roots
+	CACert string `yaml:"ca_cert"`
+	// Cert and Key are the PEM client certificate and key presented for mTLS
+	Cert               string `yaml:"cert"`
+	Key                string `yaml:"key"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// NewTransport returns a transport using the TLS settings, or
+// http.DefaultTransport when none are set
+func NewTransport(config TLSConfig) (http.RoundTripper, error) {
+	if config == (TLSConfig{}) {
+		return http.DefaultTransport, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	if config.CACert != "" {
+		pem, err := os.ReadFile(config.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("error reading ca_cert: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca_cert %s", config.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.Cert != "" || config.Key != "" {
+		cert, err := tls.LoadX509KeyPair(config.Cert, config.Key)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
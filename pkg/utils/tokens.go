@@ -0,0 +1,13 @@
+package utils
+
+import "unicode/utf8"
+
+// charsPerToken is the rough average of characters per token for English
+// text across the common BPE tokenizers
+const charsPerToken = 4
+
+// EstimateTokens estimates the token count of text without a tokenizer. It is
+// meant for coarse decisions like routing, not for billing.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + charsPerToken - 1) / charsPerToken
+}